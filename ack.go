@@ -0,0 +1,355 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Token identifies an element delivered by an AckQueue until it is acknowledged.
+type Token uint64
+
+// AckQueue is a Queue that provides at-least-once delivery. Data obtained using NextAck
+// stays in flight until it is acknowledged using Ack, and is appended again when Nack is
+// called or the visibility timeout passes first. The other methods that remove data, such
+// as Next, remove it without requiring an acknowledgement.
+type AckQueue interface {
+	Queue
+
+	// NextAck returns the data at the front of the AckQueue along with the Token
+	// used to acknowledge it. False is returned when the AckQueue is empty.
+	NextAck() (any, Token, bool)
+
+	// NextAckContext blocks until data is available at the front of the AckQueue, and then
+	// returns it along with the Token used to acknowledge it. The context error is returned
+	// once ctx is cancelled, and ErrClosed once the AckQueue is closed and drained with no
+	// data in flight. The data in flight still returns to a closed AckQueue through Nack or
+	// the visibility timeout, so NextAckContext waits for it to be settled before giving up.
+	NextAckContext(ctx context.Context) (any, Token, error)
+
+	// Ack finalizes the removal of the data delivered with the token, and
+	// returns false when the token is unknown or was already redelivered.
+	Ack(token Token) bool
+
+	// Nack appends the data delivered with the token again at its original priority, and
+	// returns false when the token is unknown or was already redelivered.
+	Nack(token Token) bool
+
+	// LenUnacked returns the number of elements in flight.
+	LenUnacked() int
+
+	// DeadLetters returns the Queue receiving the data that failed to be acknowledged after
+	// the number of redeliveries allowed by WithMaxRedeliveries. The data is appended at its
+	// original priority. Without the option, data is redelivered until it is acknowledged.
+	DeadLetters() Queue
+}
+
+type ackQueue struct {
+	*queue
+	timeout time.Duration
+	timer   *time.Timer
+	token   Token
+	// unacked holds the elements in flight, and inflight holds the same
+	// deliveries in the order they were made, which is also deadline order
+	unacked  map[Token]*delivery
+	inflight []*delivery
+	dead     Queue
+	// delayed holds the redeliveries waiting for their backoff, and
+	// the retry timer promotes them once the earliest becomes visible
+	delayed *delayed
+	retry   *time.Timer
+	// deliveries holds the number of times each redelivered element was delivered
+	deliveries *sideTable[int]
+	// settled is closed once data in flight is settled or expires, for the
+	// callers of NextAckContext waiting on a closed AckQueue
+	settled chan struct{}
+}
+
+// delivery is an element in flight along with the moment it is redelivered, the number of
+// times it was delivered, and its enqueue time when the Queue records it.
+type delivery struct {
+	e          element
+	token      Token
+	deadline   time.Time
+	deliveries int
+	stamp      time.Time
+	done       bool
+}
+
+// WithMaxRedeliveries limits an AckQueue to delivering data n more times after its first
+// delivery fails, through Nack or the visibility timeout. Once the last redelivery fails,
+// the data is moved to the DeadLetters Queue. A negative n leaves the redeliveries unlimited.
+func WithMaxRedeliveries(n int) Option {
+	return func(q *queue) {
+		if n >= 0 {
+			q.maxDeliveries = n + 1
+		}
+	}
+}
+
+// WithRetryBackoff delays each redelivery made by an AckQueue, through Nack or the visibility
+// timeout, so the data becomes visible again after base multiplied by factor once for each
+// earlier redelivery of the same data, plus a random jitter of up to half that time. Data
+// waiting for its backoff is not counted by Len or LenUnacked. A factor less than one is
+// treated as one, and a base of zero or less redelivers the data immediately.
+func WithRetryBackoff(base time.Duration, factor float64) Option {
+	return func(q *queue) {
+		q.retryBase = base
+		q.retryFactor = max(1, factor)
+	}
+}
+
+// NewAckQueue returns an initialized AckQueue that appends data in flight again once it
+// has not been acknowledged within timeout. A timeout of zero or less disables redelivery,
+// so the data stays in flight until Ack or Nack is called.
+func NewAckQueue(timeout time.Duration, opts ...Option) AckQueue {
+	q := newQueue(newLevels(numLevels))
+
+	q.configure(opts)
+	aq := &ackQueue{
+		queue:      q,
+		timeout:    max(0, timeout),
+		unacked:    make(map[Token]*delivery),
+		dead:       NewQueue(),
+		deliveries: newSideTable[int](),
+	}
+	aq.timer = time.AfterFunc(time.Hour, aq.expire)
+	aq.timer.Stop()
+
+	if q.retryBase > 0 {
+		aq.delayed = &delayed{store: q.store}
+		q.store = aq.delayed
+		q.held = aq.delayed
+		// delayed redeliveries are promoted while reading
+		q.lazy = true
+
+		aq.retry = time.AfterFunc(time.Hour, aq.wake)
+		aq.retry.Stop()
+	}
+	return aq
+}
+
+// NextAck implements the AckQueue interface.
+func (aq *ackQueue) NextAck() (any, Token, bool) {
+	aq.Lock()
+	defer aq.unlock()
+
+	e, ok := aq.store.pop()
+	if !ok {
+		aq.syncSignal()
+		return nil, 0, false
+	}
+
+	aq.token++
+	d := &delivery{
+		e:          e,
+		token:      aq.token,
+		deliveries: aq.deliveries.take(e.id) + 1,
+		stamp:      aq.stamps.get(e.id),
+	}
+	aq.dequeue(e)
+	if aq.timeout > 0 {
+		d.deadline = time.Now().Add(aq.timeout)
+		if len(aq.inflight) == 0 {
+			aq.timer.Reset(aq.timeout)
+		}
+		aq.inflight = append(aq.inflight, d)
+	}
+	aq.unacked[d.token] = d
+
+	aq.syncSignal()
+	return e.data, d.token, true
+}
+
+// NextAckContext implements the AckQueue interface.
+func (aq *ackQueue) NextAckContext(ctx context.Context) (any, Token, error) {
+	for {
+		data, token, ok := aq.NextAck()
+		if ok {
+			return data, token, nil
+		}
+
+		aq.Lock()
+		// redeliveries waiting for their backoff, and the data in flight, will still arrive
+		closed, retry := aq.closedWait()
+		var settled chan struct{}
+		if closed && len(aq.unacked) > 0 {
+			if aq.settled == nil {
+				aq.settled = make(chan struct{})
+			}
+			settled = aq.settled
+		}
+		aq.Unlock()
+
+		// the signal channel of a closed AckQueue is closed, so only the retry is awaited
+		signal := aq.Signal()
+		if closed {
+			if retry == nil && settled == nil {
+				return nil, 0, ErrClosed
+			}
+			signal = nil
+		}
+
+		select {
+		case <-signal:
+		case <-retry:
+		case <-settled:
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+}
+
+// Ack implements the AckQueue interface.
+func (aq *ackQueue) Ack(token Token) bool {
+	aq.Lock()
+	defer aq.Unlock()
+
+	return aq.settle(token) != nil
+}
+
+// Nack implements the AckQueue interface.
+func (aq *ackQueue) Nack(token Token) bool {
+	aq.Lock()
+	defer aq.unlock()
+
+	d := aq.settle(token)
+	if d == nil {
+		return false
+	}
+
+	aq.redeliver(d)
+	aq.syncSignal()
+	return true
+}
+
+// DeadLetters implements the AckQueue interface.
+func (aq *ackQueue) DeadLetters() Queue {
+	return aq.dead
+}
+
+// LenUnacked implements the AckQueue interface.
+func (aq *ackQueue) LenUnacked() int {
+	aq.Lock()
+	defer aq.Unlock()
+
+	return len(aq.unacked)
+}
+
+// Reset implements the Queue interface, and also discards the data in flight.
+func (aq *ackQueue) Reset() {
+	aq.Lock()
+	defer aq.unlock()
+
+	// the tokens keep increasing, so stale tokens are never accepted
+	clear(aq.unacked)
+	aq.inflight = nil
+	aq.deliveries.clear()
+	aq.unblock()
+	aq.reset()
+}
+
+// settle removes the delivery of the token from the elements in flight.
+func (aq *ackQueue) settle(token Token) *delivery {
+	d, found := aq.unacked[token]
+	if !found {
+		return nil
+	}
+
+	delete(aq.unacked, token)
+	aq.unblock()
+	d.done = true
+	// release the settled deliveries at the front
+	for len(aq.inflight) > 0 && aq.inflight[0].done {
+		aq.inflight[0] = nil
+		aq.inflight = aq.inflight[1:]
+	}
+	return d
+}
+
+// unblock wakes the callers of NextAckContext waiting for the data in flight.
+func (aq *ackQueue) unblock() {
+	if aq.settled != nil {
+		close(aq.settled)
+		aq.settled = nil
+	}
+}
+
+// redeliver appends the element again at the back of its original priority level, or moves
+// it to the dead letters once it has used its deliveries. The element was already counted
+// by the Queue, so the capacity is not enforced.
+func (aq *ackQueue) redeliver(d *delivery) {
+	e := d.e
+	if aq.maxDeliveries > 0 && d.deliveries >= aq.maxDeliveries {
+		aq.dead.AppendPriority(e.data, e.priority)
+		return
+	}
+
+	aq.seq++
+	e.seq = aq.seq
+	aq.deliveries.set(aq.queue, e.id, d.deliveries)
+	if aq.stamps != nil {
+		aq.stamps.set(aq.queue, e.id, d.stamp)
+	}
+	if aq.delayed != nil {
+		aq.delayed.hold(e, time.Now().Add(aq.backoff(d.deliveries)))
+		aq.schedule()
+		return
+	}
+	_ = aq.store.push(e)
+}
+
+// backoff returns the time the redelivery of an element delivered n times waits.
+func (aq *ackQueue) backoff(n int) time.Duration {
+	d := float64(aq.retryBase) * math.Pow(aq.retryFactor, float64(n-1))
+	// leave room for the jitter within a Duration
+	d = min(d, float64(math.MaxInt64/2))
+	return time.Duration(d + rand.Float64()*d/2)
+}
+
+// wake is called by the retry timer once the earliest backoff has passed.
+func (aq *ackQueue) wake() {
+	aq.Lock()
+	defer aq.unlock()
+
+	aq.delayed.promote()
+	aq.syncSignal()
+	aq.schedule()
+}
+
+// schedule sets the retry timer for the earliest redelivery waiting for its backoff.
+func (aq *ackQueue) schedule() {
+	if len(aq.delayed.pending) > 0 {
+		aq.retry.Reset(time.Until(aq.delayed.pending[0].visible))
+	}
+}
+
+// expire redelivers the elements in flight whose deadline has passed.
+func (aq *ackQueue) expire() {
+	aq.Lock()
+	defer aq.unlock()
+
+	now := time.Now()
+	for len(aq.inflight) > 0 {
+		if d := aq.inflight[0]; !d.done {
+			if d.deadline.After(now) {
+				break
+			}
+			delete(aq.unacked, d.token)
+			aq.unblock()
+			aq.redeliver(d)
+		}
+		aq.inflight[0] = nil
+		aq.inflight = aq.inflight[1:]
+	}
+	if len(aq.inflight) > 0 {
+		aq.timer.Reset(time.Until(aq.inflight[0].deadline))
+	}
+
+	aq.syncSignal()
+}
@@ -0,0 +1,195 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAckQueue(t *testing.T) {
+	q := NewAckQueue(0)
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("high", PriorityHigh)
+
+	data, token, ok := q.NextAck()
+	if !ok || data.(string) != "high" {
+		t.Fatalf("NextAck returned '%v' instead of the front of the queue", data)
+	}
+	if l, u := q.Len(), q.LenUnacked(); l != 1 || u != 1 {
+		t.Errorf("expected one element queued and one in flight, got %d and %d", l, u)
+	}
+	if !q.Ack(token) {
+		t.Errorf("Ack failed to settle the delivered token")
+	}
+	if q.Ack(token) || q.Nack(token) {
+		t.Errorf("a token was settled twice")
+	}
+
+	data, token, _ = q.NextAck()
+	q.AppendPriority("other", PriorityLow)
+	if !q.Nack(token) {
+		t.Errorf("Nack failed to settle the delivered token")
+	}
+	// the nacked element returns at the back of its original priority level
+	for _, want := range []string{"other", "low"} {
+		if have, _ := q.Next(); have.(string) != want {
+			t.Errorf("expected '%s' but got '%v'", want, have)
+		}
+	}
+	if data.(string) != "low" || q.LenUnacked() != 0 {
+		t.Errorf("the nacked element was left in flight")
+	}
+}
+
+func TestAckQueueTimeout(t *testing.T) {
+	q := NewAckQueue(30 * time.Millisecond)
+
+	q.Append("first")
+	q.Append("second")
+	_, first, _ := q.NextAck()
+	_, second, _ := q.NextAck()
+	q.Ack(second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, token, err := q.NextAckContext(ctx)
+	if err != nil || data.(string) != "first" {
+		t.Fatalf("the unacknowledged element was not redelivered, got '%v' and %v", data, err)
+	}
+	if q.Ack(first) {
+		t.Errorf("the token of an expired delivery was accepted")
+	}
+	if !q.Ack(token) {
+		t.Errorf("the token of the redelivery was rejected")
+	}
+
+	q.Close()
+	if _, _, err := q.NextAckContext(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("NextAckContext on a closed and drained queue returned %v instead of ErrClosed", err)
+	}
+}
+
+func TestAckQueueCloseInFlight(t *testing.T) {
+	q := NewAckQueue(30 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q.Append("expired")
+	q.NextAck()
+	q.Close()
+
+	// the data in flight returns to the closed AckQueue once its timeout passes
+	data, token, err := q.NextAckContext(ctx)
+	if err != nil || data.(string) != "expired" {
+		t.Fatalf("the data in flight was not redelivered after Close, got '%v' and %v", data, err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Ack(token)
+	}()
+	if _, _, err := q.NextAckContext(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed once the data in flight was acknowledged, got %v", err)
+	}
+	if q.LenUnacked() != 0 {
+		t.Errorf("NextAckContext returned ErrClosed while data was in flight")
+	}
+}
+
+func TestWithMaxRedeliveries(t *testing.T) {
+	q := NewAckQueue(0, WithMaxRedeliveries(2))
+
+	q.AppendPriority("poison", PriorityHigh)
+	for i := 0; i < 3; i++ {
+		_, token, ok := q.NextAck()
+		if !ok {
+			t.Fatalf("the element was not redelivered on attempt %d", i+1)
+		}
+		q.Nack(token)
+	}
+
+	if !q.Empty() || q.LenUnacked() != 0 {
+		t.Errorf("the element kept being redelivered after the last redelivery failed")
+	}
+	dead := q.DeadLetters()
+	if dead.LenPriority(PriorityHigh) != 1 {
+		t.Fatalf("the element was not moved to the dead letters at its original priority")
+	}
+	if data, _ := dead.Next(); data.(string) != "poison" {
+		t.Errorf("the dead letters returned '%v' instead of 'poison'", data)
+	}
+}
+
+func TestAckQueueReset(t *testing.T) {
+	q := NewAckQueue(0)
+
+	q.Append("first")
+	q.Append("second")
+	_, token, _ := q.NextAck()
+	q.Reset()
+
+	if !q.Empty() || q.LenUnacked() != 0 {
+		t.Errorf("Reset left data in the queue or in flight")
+	}
+	q.Append("fresh")
+	_, fresh, _ := q.NextAck()
+	if fresh == token || q.Ack(token) {
+		t.Errorf("a token from before Reset was accepted")
+	}
+}
+
+func TestWithRetryBackoff(t *testing.T) {
+	base := 30 * time.Millisecond
+	q := NewAckQueue(0, WithRetryBackoff(base, 2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q.Append("flaky")
+	_, token, _ := q.NextAck()
+	for _, want := range []time.Duration{base, 2 * base} {
+		start := time.Now()
+		q.Nack(token)
+
+		if _, _, ok := q.NextAck(); ok || q.Len() != 0 {
+			t.Fatalf("the nacked element was redelivered before its backoff")
+		}
+
+		var data any
+		var err error
+		data, token, err = q.NextAckContext(ctx)
+		if err != nil || data.(string) != "flaky" {
+			t.Fatalf("the nacked element was not redelivered, got '%v' and %v", data, err)
+		}
+		if waited := time.Since(start); waited < want {
+			t.Errorf("the redelivery waited %s instead of at least %s", waited, want)
+		}
+	}
+
+	// the redelivery waiting for its backoff is still delivered once the AckQueue is closed
+	q.Nack(token)
+	q.Close()
+	data, token, err := q.NextAckContext(ctx)
+	if err != nil || data.(string) != "flaky" {
+		t.Errorf("the nacked element was not redelivered after Close, got '%v' and %v", data, err)
+	}
+	q.Ack(token)
+	if _, _, err := q.NextAckContext(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed once the closed AckQueue was drained, got %v", err)
+	}
+
+	aq := q.(*ackQueue)
+	for n, want := range []time.Duration{base, 2 * base, 4 * base} {
+		if d := aq.backoff(n + 1); d < want || d >= want+want/2 {
+			t.Errorf("the backoff after %d deliveries was %s, expected %s plus up to half of that", n+1, d, want)
+		}
+	}
+}
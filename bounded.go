@@ -0,0 +1,234 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"context"
+	"slices"
+)
+
+// OverflowPolicy determines what happens when data is appended to a full bounded Queue.
+type OverflowPolicy int
+
+// The overflow policies for a bounded Queue.
+const (
+	// Reject discards the new data and leaves the Queue unchanged. This is the default.
+	Reject OverflowPolicy = iota
+	// EvictOldest removes the element appended longest ago, regardless of
+	// its priority, and then adds the new data.
+	EvictOldest
+	// EvictOldestLow removes the element appended longest ago at the lowest priority
+	// level holding data, and then adds the new data. When the new data has a priority
+	// lower than any data on the Queue, the new data is discarded instead.
+	EvictOldestLow
+)
+
+// NewBoundedQueue returns an initialized Queue that never holds more than capacity elements,
+// which is the same as using NewQueue with WithCapacity.
+func NewBoundedQueue(capacity int, opts ...Option) Queue {
+	return NewQueue(append([]Option{WithCapacity(capacity)}, opts...)...)
+}
+
+// WithCapacity bounds the Queue to never hold more than capacity elements. By default, data
+// that would exceed the capacity is discarded by Append, AppendPriority and AppendAll, and
+// rejected by TryAppend, unless another policy is set using WithOverflowPolicy. A capacity
+// less than one is unbounded.
+func WithCapacity(capacity int) Option {
+	return func(q *queue) {
+		q.capacity = max(0, capacity)
+	}
+}
+
+// WithOverflowPolicy sets the policy used when data is appended to a full bounded Queue.
+// When the policy evicts data, AppendContext never blocks due to capacity. The data that
+// EvictOldestLow discards, since its priority is lower than any data on the full Queue, is
+// reported by TryAppend returning false, while AppendContext returns nil.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(q *queue) {
+		q.overflow = policy
+	}
+}
+
+// NewQueuePerLevelCap returns an initialized Queue that never holds more elements at a
+// priority level than the capacity provided for it, which is the same as using NewQueue with
+// WithLevelCapacity.
+func NewQueuePerLevelCap(caps map[QueuePriority]int, opts ...Option) Queue {
+	return NewQueue(append([]Option{WithLevelCapacity(caps)}, opts...)...)
+}
+
+// WithLevelCapacity bounds each priority level in caps to never hold more elements than its
+// capacity, independently of the other levels and of WithCapacity. Data appended to a full
+// level is handled by the policy set using WithOverflowPolicy, except that the evicting
+// policies remove the element appended longest ago at the same level. The methods moving
+// data already queued between the levels, such as UpdatePriority, MoveAll and Rebalance,
+// never move data into a full level, and a promotion by WithDeadlinePromotion into a full
+// level is skipped. A capacity less than one leaves the level unbounded.
+func WithLevelCapacity(caps map[QueuePriority]int) Option {
+	return func(q *queue) {
+		q.levelCaps = make(map[QueuePriority]int, len(caps))
+		for p, c := range caps {
+			if c > 0 {
+				q.levelCaps[p] = c
+			}
+		}
+	}
+}
+
+// levelFull returns true when the priority level holds as many elements as its capacity.
+func (q *queue) levelFull(priority QueuePriority) bool {
+	c, bounded := q.levelCaps[priority]
+	return bounded && q.store.lenPriority(priority) >= c
+}
+
+// evictLevel removes the element appended longest ago at the priority level.
+func (q *queue) evictLevel(priority QueuePriority) {
+	var oldest element
+
+	found := false
+	q.store.walk(func(e element) bool {
+		if e.priority == priority && (!found || e.seq < oldest.seq) {
+			oldest, found = e, true
+		}
+		return true
+	})
+	if found {
+		_ = q.store.remove(func(e element) bool { return e.seq == oldest.seq }, 1)
+	}
+}
+
+// IsFull implements the Queue interface.
+func (q *queue) IsFull() bool {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.full()
+}
+
+// Reserve implements the Queue interface.
+func (q *queue) Reserve(n int) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.closed {
+		return false
+	}
+	n = max(0, n)
+	if q.capacity > 0 && q.store.len()+q.heldLen()+int(q.reserved.Load())+n > q.capacity {
+		return false
+	}
+
+	q.reserved.Add(int64(n))
+	return true
+}
+
+// AppendReserved implements the Queue interface.
+func (q *queue) AppendReserved(data any, priority QueuePriority) {
+	q.Lock()
+	defer q.unlock()
+
+	// the held slot becomes the room for the data
+	if q.reserved.Load() > 0 {
+		q.reserved.Add(-1)
+	}
+	if !q.closed && q.push(data, priority, q.stamp()) {
+		q.notify()
+	}
+}
+
+// ReleaseReservation implements the Queue interface.
+func (q *queue) ReleaseReservation(n int) {
+	q.Lock()
+	defer q.unlock()
+
+	q.reserved.Add(-min(int64(max(0, n)), q.reserved.Load()))
+	// the released slots may be taken by the blocked producers
+	q.admit()
+}
+
+// producer is a caller of AppendContext waiting for space on a bounded Queue.
+type producer struct {
+	data     any
+	priority QueuePriority
+	ready    chan struct{}
+	err      error
+}
+
+// AppendContext implements the Queue interface.
+func (q *queue) AppendContext(ctx context.Context, data any, priority QueuePriority) error {
+	q.Lock()
+	if q.closed {
+		q.unlock()
+		return ErrClosed
+	}
+	data, priority, keep := q.intercept(data, priority)
+	if !keep {
+		q.unlock()
+		return nil
+	}
+	if q.pushElement(element{data: data, priority: priority}, q.stamp()) {
+		q.notify()
+		q.unlock()
+		return nil
+	} else if q.overflow != Reject || (!q.full() && !q.levelFull(q.store.fit(priority))) {
+		// the data was discarded by the policy, or for reasons other than capacity
+		q.unlock()
+		return nil
+	}
+
+	p := &producer{
+		data:     data,
+		priority: priority,
+		ready:    make(chan struct{}),
+	}
+	q.producers = append(q.producers, p)
+	q.unlock()
+
+	select {
+	case <-p.ready:
+		return p.err
+	case <-ctx.Done():
+	}
+
+	q.Lock()
+	defer q.unlock()
+
+	select {
+	case <-p.ready:
+		// the data was admitted while acquiring the lock
+		return p.err
+	default:
+	}
+	q.producers = slices.DeleteFunc(q.producers, func(w *producer) bool { return w == p })
+	return ctx.Err()
+}
+
+// admit hands the space available on the Queue to the blocked producers in arrival order.
+func (q *queue) admit() {
+	var pushed bool
+
+	for len(q.producers) > 0 && !q.full() && !q.levelFull(q.store.fit(q.producers[0].priority)) {
+		p := q.producers[0]
+		q.producers[0] = nil
+		q.producers = q.producers[1:]
+
+		// the data was already intercepted by AppendContext
+		if q.pushElement(element{data: p.data, priority: p.priority}, q.stamp()) {
+			pushed = true
+		}
+		close(p.ready)
+	}
+	if pushed {
+		q.notify()
+	}
+}
+
+// releaseProducers wakes up all the blocked producers with the provided error.
+func (q *queue) releaseProducers(err error) {
+	for _, p := range q.producers {
+		p.err = err
+		close(p.ready)
+	}
+	q.producers = nil
+}
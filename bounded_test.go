@@ -0,0 +1,334 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTryAppend(t *testing.T) {
+	q := NewBoundedQueue(2)
+
+	if !q.TryAppend("first", PriorityLow) || !q.TryAppend("second", PriorityHigh) {
+		t.Errorf("a bounded Queue rejected data while below capacity")
+	}
+	if q.TryAppend("third", PriorityCritical) {
+		t.Errorf("a full bounded Queue accepted data beyond its capacity")
+	}
+	q.Append("dropped")
+	if l := q.Len(); l != 2 {
+		t.Errorf("a bounded Queue with a capacity of two returned a length of %d", l)
+	}
+
+	_, _ = q.Next()
+	if !q.TryAppend("fourth", PriorityNormal) {
+		t.Errorf("a bounded Queue rejected data after space was freed")
+	}
+
+	if !NewQueue().TryAppend("unbounded", PriorityNormal) {
+		t.Errorf("an unbounded Queue rejected data")
+	}
+	q.Close()
+	if q.TryAppend("closed", PriorityNormal) {
+		t.Errorf("a closed Queue accepted new data")
+	}
+}
+
+func TestIsFull(t *testing.T) {
+	if NewQueue().IsFull() {
+		t.Errorf("an unbounded queue claimed to be full")
+	}
+
+	q := NewBoundedQueue(2)
+	q.Append("first")
+	if q.IsFull() {
+		t.Errorf("a bounded queue below its capacity claimed to be full")
+	}
+	q.Append("second")
+	if !q.IsFull() {
+		t.Errorf("a bounded queue at its capacity claimed not to be full")
+	}
+}
+
+func TestReserve(t *testing.T) {
+	q := NewBoundedQueue(3)
+
+	q.Append("first")
+	if q.Reserve(3) {
+		t.Errorf("Reserve held more slots than the queue has available")
+	}
+	if !q.Reserve(2) || !q.IsFull() {
+		t.Fatalf("Reserve failed to hold the available slots")
+	}
+	if q.TryAppend("other", PriorityNormal) {
+		t.Errorf("TryAppend used a slot held by Reserve")
+	}
+
+	q.AppendReserved("second", PriorityHigh)
+	q.AppendReserved("third", PriorityLow)
+	if l := q.Len(); l != 3 {
+		t.Errorf("expected the reserved slots to hold 3 elements, got %d", l)
+	}
+	for _, want := range []string{"second", "first", "third"} {
+		if have, _ := q.Next(); have != want {
+			t.Errorf("expected '%s' but got '%v'", want, have)
+		}
+	}
+
+	if !q.Reserve(2) {
+		t.Fatalf("Reserve failed on an empty queue")
+	}
+	q.ReleaseReservation(2)
+	if !q.Reserve(3) {
+		t.Errorf("the released slots were not returned to the queue")
+	}
+	q.Reset()
+	if q.IsFull() || !q.Reserve(3) {
+		t.Errorf("the held slots were not discarded by Reset")
+	}
+	q.Close()
+	if q.Reserve(0) {
+		t.Errorf("Reserve succeeded on a closed queue")
+	}
+}
+
+func TestBoundedQueueConcurrent(t *testing.T) {
+	capacity := 100
+	q := NewBoundedQueue(capacity)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				q.AppendPriority(j, QueuePriority(j%4))
+				if l := q.Len(); l > capacity {
+					t.Errorf("the bounded Queue length %d exceeded the capacity %d", l, capacity)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if l := q.Len(); l != capacity {
+		t.Errorf("expected the bounded Queue to be filled to %d elements, got %d", capacity, l)
+	}
+}
+
+func TestAppendContext(t *testing.T) {
+	q := NewBoundedQueue(1)
+
+	if err := q.AppendContext(context.Background(), "first", PriorityNormal); err != nil {
+		t.Fatalf("a bounded Queue below capacity returned %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.AppendContext(ctx, "expired", PriorityNormal); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("a blocked producer returned %v instead of the context error", err)
+	}
+
+	// Blocked producers must be admitted in the order they arrived
+	var wg sync.WaitGroup
+	producers := []string{"p1", "p2", "p3"}
+	for i, name := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := q.AppendContext(context.Background(), name, PriorityNormal); err != nil {
+				t.Errorf("the blocked producer %s returned %v", name, err)
+			}
+		}()
+		waitForProducers(q, i+1)
+	}
+
+	for _, want := range append([]string{"first"}, producers...) {
+		if have, _ := q.Next(); have != want {
+			t.Errorf("element admitted out of order, expected '%s' but got '%v'", want, have)
+		}
+		if l := q.Len(); l > 1 {
+			t.Errorf("the bounded Queue length %d exceeded the capacity", l)
+		}
+	}
+	wg.Wait()
+
+	q.Append("filler")
+	done := make(chan error, 1)
+	go func() {
+		done <- q.AppendContext(context.Background(), "blocked", PriorityNormal)
+	}()
+	waitForProducers(q, 1)
+	q.Close()
+	if err := <-done; !errors.Is(err, ErrClosed) {
+		t.Errorf("closing the Queue returned %v to a blocked producer instead of ErrClosed", err)
+	}
+}
+
+func waitForProducers(q Queue, n int) {
+	for {
+		iq := q.(*queue)
+
+		iq.Lock()
+		waiting := len(iq.producers)
+		iq.Unlock()
+		if waiting >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWithOverflowPolicy(t *testing.T) {
+	tests := []struct {
+		policy   OverflowPolicy
+		incoming QueuePriority
+		accepted bool
+		expected []string
+	}{
+		{Reject, PriorityCritical, false, []string{"high", "norm1", "norm2"}},
+		{EvictOldest, PriorityLow, true, []string{"high", "norm2", "new"}},
+		{EvictOldestLow, PriorityCritical, true, []string{"new", "high", "norm2"}},
+		{EvictOldestLow, PriorityNormal, true, []string{"high", "norm2", "new"}},
+		{EvictOldestLow, PriorityLow, false, []string{"high", "norm1", "norm2"}},
+	}
+
+	for _, test := range tests {
+		q := NewBoundedQueue(3, WithOverflowPolicy(test.policy))
+
+		q.AppendPriority("norm1", PriorityNormal)
+		q.AppendPriority("high", PriorityHigh)
+		q.AppendPriority("norm2", PriorityNormal)
+		if accepted := q.TryAppend("new", test.incoming); accepted != test.accepted {
+			t.Errorf("policy %d returned %t instead of %t for priority %d", test.policy, accepted, test.accepted, test.incoming)
+		}
+
+		elements := q.DrainAll()
+		if len(elements) != len(test.expected) {
+			t.Errorf("policy %d left %d elements instead of %d", test.policy, len(elements), len(test.expected))
+			continue
+		}
+		for i, want := range test.expected {
+			if have := elements[i].(string); have != want {
+				t.Errorf("policy %d: element %d was '%s' instead of '%s'", test.policy, i, have, want)
+			}
+		}
+	}
+
+	// the data discarded by the policy never blocks AppendContext
+	q := NewBoundedQueue(1, WithOverflowPolicy(EvictOldestLow))
+	q.Append("norm")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := q.AppendContext(ctx, "low", PriorityLow); err != nil {
+		t.Errorf("AppendContext blocked on data discarded by the policy: %v", err)
+	}
+	if have, _ := q.Next(); have != "norm" {
+		t.Errorf("expected the lower priority data to be discarded, got %v", have)
+	}
+}
+
+func TestNewQueuePerLevelCap(t *testing.T) {
+	caps := map[QueuePriority]int{PriorityLow: 2, PriorityCritical: 1}
+
+	q := NewQueuePerLevelCap(caps)
+	for i := 0; i < 5; i++ {
+		q.AppendPriority(i, PriorityLow)
+		q.Append(i)
+	}
+	if l := q.LenPriority(PriorityLow); l != 2 {
+		t.Errorf("expected the low level to be capped at 2 elements, got %d", l)
+	}
+	if l := q.LenPriority(PriorityNormal); l != 5 {
+		t.Errorf("expected the unbounded level to hold 5 elements, got %d", l)
+	}
+	if !q.TryAppend("crit", PriorityCritical) || q.TryAppend("rejected", PriorityCritical) {
+		t.Errorf("TryAppend ignored the capacity of the critical level")
+	}
+
+	q = NewQueuePerLevelCap(caps, WithOverflowPolicy(EvictOldest))
+	for i := 0; i < 5; i++ {
+		q.AppendPriority(i, PriorityLow)
+	}
+	q.Append("norm")
+	for _, want := range []any{"norm", 3, 4} {
+		if have, _ := q.Next(); have != want {
+			t.Errorf("expected %v but got %v", want, have)
+		}
+	}
+}
+
+func TestLevelCapacityMoves(t *testing.T) {
+	q := NewQueuePerLevelCap(map[QueuePriority]int{PriorityHigh: 1})
+
+	q.AppendPriority("high", PriorityHigh)
+	q.Append("first")
+	q.Append("second")
+	if q.UpdatePriority("first", PriorityHigh) {
+		t.Errorf("UpdatePriority moved the data into a full level")
+	}
+	if n := q.MoveAll(PriorityNormal, PriorityHigh); n != 0 {
+		t.Errorf("MoveAll moved %d elements into a full level", n)
+	}
+	q.Rebalance(func(any, QueuePriority) QueuePriority { return PriorityHigh })
+	if l := q.LenPriority(PriorityHigh); l != 1 {
+		t.Errorf("expected the high level to remain capped at 1 element, got %d", l)
+	}
+
+	q.Next()
+	if n := q.MoveAll(PriorityNormal, PriorityHigh); n != 1 {
+		t.Errorf("expected MoveAll to move the 1 element that fits, got %d", n)
+	}
+	if have, _ := q.NextPriority(PriorityHigh); have != "first" {
+		t.Errorf("expected MoveAll to move the element appended first, got %v", have)
+	}
+	if l := q.LenPriority(PriorityNormal); l != 1 {
+		t.Errorf("expected the element that did not fit to remain, got %d elements", l)
+	}
+
+	q = NewQueuePerLevelCap(map[QueuePriority]int{PriorityCritical: 1},
+		WithDeadlinePromotion(0, 30*time.Millisecond))
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendDeadline("deadline", time.Now().Add(50*time.Millisecond))
+	time.Sleep(40 * time.Millisecond)
+	if l := q.LenPriority(PriorityCritical); l != 1 {
+		t.Errorf("expected the promotion into a full level to be skipped, got %d elements", l)
+	}
+	if l := q.LenPriority(PriorityNormal); l != 1 {
+		t.Errorf("expected the data to remain at its level, got %d elements", l)
+	}
+}
+
+func TestOverflowRejectedAppend(t *testing.T) {
+	q := NewBoundedQueue(2, WithOverflowPolicy(EvictOldest), WithDedup(func(data any) string {
+		return data.(string)
+	}))
+
+	q.Append("first")
+	q.Append("second")
+	// the duplicate is discarded without evicting data to make room for it
+	q.Append("second")
+	if have := q.Snapshot(); len(have) != 2 || have[0] != "first" {
+		t.Errorf("a discarded duplicate evicted data from the full queue, leaving %v", have)
+	}
+
+	// data with an invalid priority is kept, so the signal never claims missing data
+	e := NewQueue()
+	e.AppendPriority("unknown", QueuePriority(7))
+	select {
+	case <-e.Signal():
+		if _, ok := e.Next(); !ok {
+			t.Errorf("the signal was asserted without data on the queue")
+		}
+	default:
+		t.Errorf("data appended with an invalid priority was lost")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"slices"
+	"sync"
+)
+
+// BroadcastQueue delivers every element appended to each of its subscribers, instead of
+// having the consumers compete for the elements. Each subscriber has its own priority
+// Queue, so a subscriber receives the elements in priority order, and elements at the
+// same priority in the order they were appended.
+type BroadcastQueue struct {
+	mu     sync.Mutex
+	buffer int
+	policy OverflowPolicy
+	subs   []Queue
+	closed bool
+}
+
+// NewBroadcastQueue returns an initialized BroadcastQueue that buffers up to buffer elements
+// for each subscriber, in addition to the element waiting to be received, or an unlimited
+// number when buffer is less than one. The policy determines what happens once the buffer
+// of a slow subscriber is full. EvictOldest and EvictOldestLow discard elements from the
+// buffer of the subscriber as they do for a bounded Queue. Reject drops the subscriber,
+// whose channel is closed after the elements already buffered have been received.
+func NewBroadcastQueue(buffer int, policy OverflowPolicy) *BroadcastQueue {
+	return &BroadcastQueue{
+		buffer: max(0, buffer),
+		policy: policy,
+	}
+}
+
+// Subscribe returns a new channel that receives each element appended from now on.
+// The channel is closed once the BroadcastQueue is closed and the channel is drained,
+// or once the subscriber is dropped. A closed BroadcastQueue returns a closed channel.
+func (b *BroadcastQueue) Subscribe() <-chan any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q := NewBoundedQueue(b.buffer, WithOverflowPolicy(b.policy))
+	if b.closed {
+		q.Close()
+	} else {
+		b.subs = append(b.subs, q)
+	}
+	return q.Channel()
+}
+
+// Subscribers returns the current number of subscribers.
+func (b *BroadcastQueue) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subs)
+}
+
+// Append delivers the data to each subscriber at priority level PriorityNormal.
+func (b *BroadcastQueue) Append(data any) {
+	b.AppendPriority(data, PriorityNormal)
+}
+
+// AppendPriority delivers the data to each subscriber with respect to priority.
+func (b *BroadcastQueue) AppendPriority(data any, priority QueuePriority) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.subs = slices.DeleteFunc(b.subs, func(q Queue) bool {
+		if q.TryAppend(data, priority) || b.policy != Reject {
+			return false
+		}
+
+		// the subscriber is too slow to keep up with the data
+		q.Close()
+		return true
+	})
+}
+
+// Close marks the BroadcastQueue closed and closes each subscriber channel once the
+// elements already buffered have been received. Calling Close more than once is safe.
+func (b *BroadcastQueue) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.closed = true
+	for _, q := range b.subs {
+		q.Close()
+	}
+	b.subs = nil
+}
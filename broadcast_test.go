@@ -0,0 +1,74 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBroadcastQueue(t *testing.T) {
+	b := NewBroadcastQueue(0, Reject)
+	first := b.Subscribe()
+	second := b.Subscribe()
+
+	b.Append("one")
+	b.AppendPriority("two", PriorityNormal)
+	b.Close()
+	b.Close()
+
+	for i, ch := range []<-chan any{first, second} {
+		var have []any
+		for data := range ch {
+			have = append(have, data)
+		}
+		if len(have) != 2 || have[0] != "one" || have[1] != "two" {
+			t.Errorf("subscriber %d received %v instead of every element in order", i, have)
+		}
+	}
+
+	if _, ok := <-b.Subscribe(); ok {
+		t.Errorf("a closed BroadcastQueue returned an open channel")
+	}
+}
+
+func TestBroadcastQueueSlowSubscriber(t *testing.T) {
+	b := NewBroadcastQueue(2, Reject)
+	slow := b.Subscribe()
+
+	// the feeding goroutine holds one element while waiting for the receiver
+	b.Append("one")
+	time.Sleep(20 * time.Millisecond)
+	for _, data := range []string{"two", "three", "four"} {
+		b.Append(data)
+	}
+	if n := b.Subscribers(); n != 0 {
+		t.Errorf("the slow subscriber was not dropped, %d subscribers remain", n)
+	}
+
+	var count int
+	for range slow {
+		count++
+	}
+	if count != 3 {
+		t.Errorf("the dropped subscriber received %d elements instead of the three buffered", count)
+	}
+
+	b = NewBroadcastQueue(1, EvictOldest)
+	evicting := b.Subscribe()
+	b.Append("one")
+	time.Sleep(20 * time.Millisecond)
+	b.Append("two")
+	b.Append("three")
+	b.Close()
+
+	var have []any
+	for data := range evicting {
+		have = append(have, data)
+	}
+	if len(have) != 2 || have[0] != "one" || have[1] != "three" {
+		t.Errorf("the evicting subscriber received %v instead of 'one' and 'three'", have)
+	}
+}
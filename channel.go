@@ -0,0 +1,61 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "context"
+
+// Channel implements the Queue interface.
+func (q *queue) Channel() <-chan any {
+	q.outOnce.Do(func() {
+		q.out = make(chan any)
+		go q.feed(q.out)
+	})
+	return q.out
+}
+
+// Channels implements the Queue interface.
+func (q *queue) Channels(n int) []<-chan any {
+	if n < 1 {
+		return nil
+	}
+
+	outs := make([]chan any, n)
+	results := make([]<-chan any, n)
+	for i := range outs {
+		outs[i] = make(chan any)
+		results[i] = outs[i]
+	}
+
+	go q.feedAll(outs)
+	return results
+}
+
+func (q *queue) feedAll(outs []chan any) {
+	defer func() {
+		for _, out := range outs {
+			close(out)
+		}
+	}()
+
+	for turn := 0; ; turn = (turn + 1) % len(outs) {
+		data, _, err := q.NextContext(context.Background())
+		if err != nil {
+			return
+		}
+		outs[turn] <- data
+	}
+}
+
+func (q *queue) feed(out chan<- any) {
+	defer close(out)
+
+	for {
+		data, _, err := q.NextContext(context.Background())
+		if err != nil {
+			return
+		}
+		out <- data
+	}
+}
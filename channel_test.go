@@ -0,0 +1,93 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChannel(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendPriority("norm", PriorityNormal)
+	ch := q.Channel()
+	if q.Channel() != ch {
+		t.Errorf("Channel returned a different channel on the second call")
+	}
+
+	for _, want := range []string{"crit", "norm", "low"} {
+		if have := <-ch; have.(string) != want {
+			t.Errorf("element received out of priority order, expected '%s' but got '%s'", want, have)
+		}
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Append("delayed")
+		q.Close()
+	}()
+
+	var received []any
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+loop:
+	for {
+		select {
+		case data, ok := <-ch:
+			if !ok {
+				break loop
+			}
+			received = append(received, data)
+		case <-timer.C:
+			t.Fatalf("the channel was not closed after the Queue was closed")
+		}
+	}
+	if len(received) != 1 || received[0].(string) != "delayed" {
+		t.Errorf("expected the delayed element before the channel closed, got %v", received)
+	}
+}
+
+func TestChannels(t *testing.T) {
+	q := NewQueue()
+
+	if chs := q.Channels(0); len(chs) != 0 {
+		t.Errorf("Channels returned %d channels when none were requested", len(chs))
+	}
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendPriority("norm", PriorityNormal)
+	chs := q.Channels(2)
+	if len(chs) != 2 {
+		t.Fatalf("expected 2 channels, got %d", len(chs))
+	}
+
+	// the channels take turns in the priority order
+	for i, want := range []string{"crit", "norm", "low"} {
+		select {
+		case have := <-chs[i%2]:
+			if have != want {
+				t.Errorf("channel %d received '%v' instead of '%s'", i%2, have, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("channel %d did not receive '%s'", i%2, want)
+		}
+	}
+
+	q.Close()
+	for i, ch := range chs {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				t.Errorf("channel %d received data after the Queue was drained", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("channel %d was not closed after the Queue was closed", i)
+		}
+	}
+}
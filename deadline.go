@@ -0,0 +1,385 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"container/heap"
+	"time"
+	"unsafe"
+)
+
+// WithDeadlinePromotion promotes the data appended using AppendDeadline as its deadline nears,
+// to PriorityHigh once the deadline is less than high away, and to PriorityCritical once it
+// is less than critical away, so the data closest to its deadline is served first. An internal
+// timer promotes the data as each threshold passes, which asserts the channels returned by
+// SignalPriority. A promoted element joins the back of its new level, as if appended again,
+// so it receives a new sequence number. Moving the data to another level, such as by
+// UpdatePriority, MoveAll or Rebalance, or to another Queue, such as by Split or Merge, ends
+// its promotion, while the data that Rebalance leaves at its level keeps it. A promotion
+// into a level that is full under WithLevelCapacity is skipped, leaving the data at its level
+// until the next threshold. A duration of zero or less disables the promotion to that level.
+func WithDeadlinePromotion(high, critical time.Duration) Option {
+	return func(q *queue) {
+		q.promoteHigh = max(0, high)
+		q.promoteCritical = max(0, critical)
+	}
+}
+
+// AppendDeadline implements the Queue interface.
+func (q *queue) AppendDeadline(data any, deadline time.Time) {
+	q.Lock()
+	defer q.unlock()
+
+	if q.closed {
+		return
+	}
+
+	if q.deadlines == nil {
+		if q.push(data, PriorityNormal, q.stamp()) {
+			q.notify()
+		}
+		return
+	}
+
+	q.deadlines.due = deadline
+	pushed := q.push(data, q.deadlines.stage(PriorityNormal, deadline, time.Now()), q.stamp())
+	q.deadlines.due = time.Time{}
+	if pushed {
+		q.schedulePromotion()
+		q.notify()
+	}
+}
+
+// promoteDue is called by the promoter timer once the earliest promotion is due.
+func (q *queue) promoteDue() {
+	q.Lock()
+	defer q.unlock()
+
+	q.deadlines.promote()
+	q.syncSignal()
+	q.schedulePromotion()
+}
+
+// schedulePromotion sets the promoter timer for the earliest promotion.
+func (q *queue) schedulePromotion() {
+	if !q.closed && len(q.deadlines.pending) > 0 {
+		q.promoter.Reset(time.Until(q.deadlines.pending[0].at))
+	}
+}
+
+func (q *queue) stopPromotion() {
+	if q.promoter != nil {
+		q.promoter.Stop()
+	}
+}
+
+// deadlined wraps a store to promote the elements appended with a deadline. Each operation
+// reading the priority levels first promotes the elements whose threshold has passed.
+//
+// A promotion pushes a copy of the element at its new level with a new sequence number, and
+// leaves the element at its former level behind as stale, so no scan of the store is needed.
+// The stale elements are skipped and discarded as they are reached.
+type deadlined struct {
+	store
+	high     time.Duration
+	critical time.Duration
+	// caps is the capacity of the levels bounded by WithLevelCapacity
+	caps map[QueuePriority]int
+	// seq is the sequence number of the Queue, which also numbers the promoted copies
+	seq *uint64
+	// due is the deadline of the element being appended by AppendDeadline
+	due time.Time
+	// pending orders the promotions by the time they are due, and tracked
+	// indexes them by the sequence number of their element
+	pending promotionHeap
+	tracked map[uint64]*promotion
+	// stale holds the priority of each element left behind by a promotion,
+	// and staleAt the number of them at each level
+	stale   map[uint64]QueuePriority
+	staleAt map[QueuePriority]int
+	// promoted is called with each promoted element, while the lock is held
+	promoted func(e element)
+	// held keeps the promotions of the elements removed by Rebalance, so those stored
+	// again at the same level are tracked again, and is nil otherwise
+	held map[uint64]*promotion
+}
+
+// promotion is the next change of level for an element with a deadline.
+type promotion struct {
+	e        element
+	deadline time.Time
+	at       time.Time
+	index    int
+}
+
+// stage returns the priority of an element with the deadline at now, which is never lower
+// than its current priority.
+func (d *deadlined) stage(current QueuePriority, deadline, now time.Time) QueuePriority {
+	left := deadline.Sub(now)
+
+	switch {
+	case d.critical > 0 && left < d.critical:
+		current = max(current, PriorityCritical)
+	case d.high > 0 && left < d.high:
+		current = max(current, PriorityHigh)
+	}
+	return current
+}
+
+// track schedules the next promotion of the stored element, at the first of its thresholds
+// that passes after the time provided.
+func (d *deadlined) track(e element, deadline, after time.Time) {
+	var at time.Time
+
+	if c := deadline.Add(-d.critical); d.critical > 0 && e.priority < PriorityCritical && c.After(after) {
+		at = c
+	}
+	if h := deadline.Add(-d.high); d.high > 0 && e.priority < PriorityHigh && h.After(after) {
+		if at.IsZero() || h.Before(at) {
+			at = h
+		}
+	}
+	if !at.IsZero() && d.fit(PriorityCritical) > e.priority {
+		p := &promotion{e: e, deadline: deadline, at: at}
+		heap.Push(&d.pending, p)
+		d.tracked[e.seq] = p
+	}
+}
+
+// promote moves the elements whose threshold has passed to their new level.
+func (d *deadlined) promote() {
+	if len(d.pending) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for len(d.pending) > 0 && !d.pending[0].at.After(now) {
+		p := heap.Pop(&d.pending).(*promotion)
+		delete(d.tracked, p.e.seq)
+
+		e := p.e
+		if e.priority = d.fit(d.stage(e.priority, p.deadline, now)); e.priority == p.e.priority {
+			continue
+		}
+		if d.full(e.priority) {
+			// the element waits at its level for the next threshold
+			d.track(p.e, p.deadline, now)
+			continue
+		}
+
+		d.stale[p.e.seq] = p.e.priority
+		d.staleAt[p.e.priority]++
+		*d.seq++
+		e.seq = *d.seq
+		_ = d.store.push(e)
+		d.track(e, p.deadline, time.Time{})
+		if d.promoted != nil {
+			d.promoted(e)
+		}
+	}
+}
+
+// full returns true when the priority level holds as many elements as its capacity.
+func (d *deadlined) full(priority QueuePriority) bool {
+	c, bounded := d.caps[priority]
+	return bounded && d.store.lenPriority(priority)-d.staleAt[priority] >= c
+}
+
+// discard returns true when the element removed from the store was left behind by a
+// promotion, and forgets the promotion of the element otherwise.
+func (d *deadlined) discard(e element) bool {
+	if priority, found := d.stale[e.seq]; found {
+		delete(d.stale, e.seq)
+		if d.staleAt[priority]--; d.staleAt[priority] == 0 {
+			delete(d.staleAt, priority)
+		}
+		return true
+	}
+
+	if p, found := d.tracked[e.seq]; found {
+		heap.Remove(&d.pending, p.index)
+		delete(d.tracked, e.seq)
+		if d.held != nil {
+			d.held[e.seq] = p
+		}
+	}
+	return false
+}
+
+func (d *deadlined) isStale(e element) bool {
+	_, found := d.stale[e.seq]
+	return found
+}
+
+func (d *deadlined) push(e element) bool {
+	if !d.store.push(e) {
+		return false
+	}
+	if !d.due.IsZero() {
+		d.track(e, d.due, time.Time{})
+	} else if p, found := d.held[e.seq]; found {
+		delete(d.held, e.seq)
+		if p.e.priority == e.priority {
+			d.track(e, p.deadline, time.Time{})
+		}
+	}
+	return true
+}
+
+func (d *deadlined) pop() (element, bool) {
+	d.promote()
+	for {
+		e, ok := d.store.pop()
+		if !ok || !d.discard(e) {
+			return e, ok
+		}
+	}
+}
+
+func (d *deadlined) peek() (element, bool) {
+	d.promote()
+	for {
+		e, ok := d.store.peek()
+		if !ok || !d.isStale(e) {
+			return e, ok
+		}
+		// the element served first is also served first at its level
+		_ = d.discard(e)
+		_, _ = d.store.popPriority(e.priority)
+	}
+}
+
+func (d *deadlined) popPriority(priority QueuePriority) (element, bool) {
+	d.promote()
+	for {
+		e, ok := d.store.popPriority(priority)
+		if !ok || !d.discard(e) {
+			return e, ok
+		}
+	}
+}
+
+func (d *deadlined) peekPriority(priority QueuePriority) (element, bool) {
+	d.promote()
+	for {
+		e, ok := d.store.peekPriority(priority)
+		if !ok || !d.isStale(e) {
+			return e, ok
+		}
+		_ = d.discard(e)
+		_, _ = d.store.popPriority(priority)
+	}
+}
+
+func (d *deadlined) len() int {
+	d.promote()
+	return d.store.len() - len(d.stale)
+}
+
+func (d *deadlined) lenPriority(priority QueuePriority) int {
+	d.promote()
+	return d.store.lenPriority(priority) - d.staleAt[priority]
+}
+
+func (d *deadlined) eachLevel(fn func(priority QueuePriority, n int)) {
+	d.promote()
+	d.store.eachLevel(func(p QueuePriority, n int) {
+		fn(p, n-d.staleAt[p])
+	})
+}
+
+func (d *deadlined) evict(policy OverflowPolicy, priority QueuePriority) (element, bool) {
+	d.promote()
+	for {
+		e, ok := d.store.evict(policy, priority)
+		if !ok || !d.discard(e) {
+			return e, ok
+		}
+	}
+}
+
+func (d *deadlined) walk(fn func(e element) bool) {
+	d.promote()
+	d.store.walk(func(e element) bool {
+		return d.isStale(e) || fn(e)
+	})
+}
+
+func (d *deadlined) remove(match func(e element) bool, limit int) []element {
+	d.promote()
+	removed := d.store.remove(func(e element) bool {
+		return !d.isStale(e) && match(e)
+	}, limit)
+
+	for _, e := range removed {
+		_ = d.discard(e)
+	}
+	return removed
+}
+
+// promotionSize is the memory used by each pending promotion and its place in the heap.
+const promotionSize = int(unsafe.Sizeof(promotion{}) + unsafe.Sizeof(&promotion{}))
+
+func (d *deadlined) footprint() int {
+	return d.store.footprint() + cap(d.pending)*promotionSize
+}
+
+func (d *deadlined) compact() {
+	if len(d.stale) > 0 {
+		_ = d.store.remove(d.isStale, 0)
+		clear(d.stale)
+		clear(d.staleAt)
+	}
+	d.store.compact()
+	if len(d.pending) == 0 {
+		d.pending = nil
+	}
+}
+
+func (d *deadlined) clear() {
+	d.store.clear()
+	d.pending = nil
+	clear(d.tracked)
+	clear(d.stale)
+	clear(d.staleAt)
+}
+
+// promotionHeap orders the promotions by the time they are due.
+type promotionHeap []*promotion
+
+// Len implements the heap.Interface.
+func (p promotionHeap) Len() int { return len(p) }
+
+// Less implements the heap.Interface.
+func (p promotionHeap) Less(i, j int) bool {
+	if !p[i].at.Equal(p[j].at) {
+		return p[i].at.Before(p[j].at)
+	}
+	return p[i].e.seq < p[j].e.seq
+}
+
+// Swap implements the heap.Interface.
+func (p promotionHeap) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+	p[i].index = i
+	p[j].index = j
+}
+
+// Push implements the heap.Interface.
+func (p *promotionHeap) Push(x any) {
+	pr := x.(*promotion)
+	pr.index = len(*p)
+	*p = append(*p, pr)
+}
+
+// Pop implements the heap.Interface.
+func (p *promotionHeap) Pop() any {
+	old := *p
+	last := len(old) - 1
+	pr := old[last]
+	old[last] = nil // prevent memory leak
+	*p = old[:last]
+	return pr
+}
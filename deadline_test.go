@@ -0,0 +1,125 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithDeadlinePromotion(t *testing.T) {
+	q := NewQueue(WithDeadlinePromotion(60*time.Millisecond, 30*time.Millisecond))
+
+	deadline := time.Now().Add(100 * time.Millisecond)
+	q.Append("first")
+	q.AppendDeadline("deadline", deadline)
+	if l := q.LenPriority(PriorityNormal); l != 2 {
+		t.Errorf("expected the data with a distant deadline to be appended at the normal level, got %d elements", l)
+	}
+
+	for _, stage := range []struct {
+		priority QueuePriority
+		before   time.Duration
+	}{
+		{PriorityHigh, 60 * time.Millisecond},
+		{PriorityCritical, 30 * time.Millisecond},
+	} {
+		timeout := time.Now().Add(5 * time.Second)
+		for q.LenPriority(stage.priority) == 0 {
+			if time.Now().After(timeout) {
+				t.Fatalf("the data was not promoted to %s", stage.priority)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if left := time.Until(deadline); left >= stage.before {
+			t.Errorf("the data was promoted to %s with %s left before its deadline", stage.priority, left)
+		}
+	}
+
+	if data, ok := q.Next(); !ok || data != "deadline" {
+		t.Errorf("expected the promoted data to be served first, got '%v'", data)
+	}
+	if data, ok := q.Next(); !ok || data != "first" {
+		t.Errorf("expected 'first' to remain on the queue, got '%v'", data)
+	}
+
+	// data appended close to its deadline starts at the promoted level
+	q.AppendDeadline("urgent", time.Now().Add(10*time.Millisecond))
+	if data, priority, _ := q.NextWithPriority(); data != "urgent" || priority != PriorityCritical {
+		t.Errorf("expected 'urgent' at %s, got '%v' at %s", PriorityCritical, data, priority)
+	}
+
+	// the promotions of the data leaving the Queue are forgotten
+	for range 1000 {
+		q.AppendDeadline("distant", time.Now().Add(24*time.Hour))
+		q.Next()
+	}
+	if pending := len(q.(*queue).deadlines.pending); pending != 0 {
+		t.Errorf("expected no pending promotions on an empty queue, got %d", pending)
+	}
+
+	plain := NewQueue()
+	plain.AppendDeadline("ignored", time.Now())
+	if _, priority, _ := plain.NextWithPriority(); priority != PriorityNormal {
+		t.Errorf("the deadline was not ignored without WithDeadlinePromotion, got the priority %s", priority)
+	}
+}
+
+func TestDeadlinePromotionSignal(t *testing.T) {
+	q := NewQueue(WithDeadlinePromotion(0, 30*time.Millisecond))
+	critical := q.SignalPriority(PriorityCritical)
+
+	q.AppendDeadline("deadline", time.Now().Add(50*time.Millisecond))
+	select {
+	case <-critical:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the signal was not asserted when the data was promoted to %s", PriorityCritical)
+	}
+	if data, priority, _ := q.NextWithPriority(); data != "deadline" || priority != PriorityCritical {
+		t.Errorf("expected 'deadline' at %s, got '%v' at %s", PriorityCritical, data, priority)
+	}
+
+	// a promoted element keeps its key on a deduplicating Queue
+	q = NewQueue(WithDeadlinePromotion(0, 30*time.Millisecond), WithDedup(func(data any) string { return data.(string) }))
+	q.AppendDeadline("dup", time.Now().Add(40*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	q.AppendPriority("dup", PriorityCritical)
+	q.AppendPriority("dup", PriorityHigh)
+	if l, c := q.Len(), q.LenPriority(PriorityCritical); l != 1 || c != 1 {
+		t.Errorf("a promoted element was duplicated, got %d elements and %d at %s", l, c, PriorityCritical)
+	}
+}
+
+func TestDeadlinePromotionRebalance(t *testing.T) {
+	q := NewQueue(WithDeadlinePromotion(0, 30*time.Millisecond))
+
+	q.AppendDeadline("kept", time.Now().Add(50*time.Millisecond))
+	q.AppendDeadline("moved", time.Now().Add(50*time.Millisecond))
+	q.Rebalance(func(data any, current QueuePriority) QueuePriority {
+		if data == "moved" {
+			return PriorityLow
+		}
+		return current
+	})
+
+	timeout := time.Now().Add(5 * time.Second)
+	for q.LenPriority(PriorityCritical) == 0 {
+		if time.Now().After(timeout) {
+			t.Fatalf("the data left at its level by Rebalance was not promoted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if l := q.LenPriority(PriorityLow); l != 1 {
+		t.Errorf("expected the data moved by Rebalance to remain at %s, got %d elements", PriorityLow, l)
+	}
+	if data, priority, _ := q.NextWithPriority(); data != "kept" || priority != PriorityCritical {
+		t.Errorf("expected 'kept' at %s, got '%v' at %s", PriorityCritical, data, priority)
+	}
+	if pending := len(q.(*queue).deadlines.pending); pending != 0 {
+		t.Errorf("expected no pending promotions once the promoted data left, got %d", pending)
+	}
+}
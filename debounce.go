@@ -0,0 +1,61 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "time"
+
+// WithSignalDebounce delays asserting the signal channel until d has passed since the last
+// wakeup, so a burst of appends wakes a consumer waiting on the signal only once. A token
+// already in the channel is never delayed, and methods such as Next keep returning the data
+// while the wakeup is deferred. Without the option, the signal is asserted immediately.
+func WithSignalDebounce(d time.Duration) Option {
+	return func(q *queue) {
+		q.debounce = max(0, d)
+	}
+}
+
+// debounced returns true when the wakeup is deferred to the debouncer timer, or records the
+// wakeup when it can happen now.
+func (q *queue) debounced() bool {
+	now := time.Now()
+
+	wait := q.debounce - now.Sub(q.woke)
+	if wait <= 0 {
+		q.woke = now
+		return false
+	}
+
+	if !q.deferred {
+		q.deferred = true
+		if q.debouncer == nil {
+			q.debouncer = time.AfterFunc(wait, q.flushSignal)
+		} else {
+			q.debouncer.Reset(wait)
+		}
+	}
+	return true
+}
+
+// flushSignal asserts the deferred wakeup, if data is still on the Queue.
+func (q *queue) flushSignal() {
+	q.Lock()
+	defer q.Unlock()
+
+	if !q.deferred {
+		return
+	}
+
+	q.deferred = false
+	if !q.closed && q.store.len() > 0 {
+		q.assert()
+	}
+}
+
+func (q *queue) stopDebounce() {
+	if q.debouncer != nil {
+		q.debouncer.Stop()
+	}
+	q.deferred = false
+}
@@ -0,0 +1,49 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithSignalDebounce(t *testing.T) {
+	q := NewQueue(WithSignalDebounce(50 * time.Millisecond))
+
+	// the first wakeup is immediate
+	q.Append("first")
+	select {
+	case <-q.Signal():
+	default:
+		t.Fatalf("the first wakeup was delayed")
+	}
+	_, _ = q.Next()
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		q.Append(i)
+	}
+	select {
+	case <-q.Signal():
+		t.Errorf("the burst woke the consumer before the debounce passed")
+	default:
+	}
+	if q.Len() != 10 {
+		t.Errorf("the data was not available while the wakeup was deferred")
+	}
+
+	select {
+	case <-q.Signal():
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Errorf("the deferred wakeup happened after only %v", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the deferred wakeup never happened")
+	}
+	if n := len(q.NextN(20)); n != 10 {
+		t.Errorf("the consumer received %d elements instead of the whole burst", n)
+	}
+	q.Close()
+}
@@ -0,0 +1,94 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "maps"
+
+// dedup wraps a store to hold at most one element for each key.
+type dedup struct {
+	store
+	key  func(any) string
+	keys map[string]element
+	// held is the store beneath holding the elements of a DelayQueue that are not yet visible
+	held *delayed
+}
+
+// NewDedupQueue returns an initialized Queue that holds at most one element for each key
+// returned by the key function, which is the same as using NewQueue with WithDedup.
+func NewDedupQueue(key func(any) string, opts ...Option) Queue {
+	return NewQueue(append([]Option{WithDedup(key)}, opts...)...)
+}
+
+// WithDedup holds at most one element for each key returned by the key function. Data is
+// discarded when an element with the same key is already queued at the same or a higher
+// priority. When data arrives at a higher priority than the queued element with the same
+// key, the queued element is removed and the new data is appended at the higher priority.
+// A key can be queued again once its element has left the Queue.
+func WithDedup(key func(any) string) Option {
+	return func(q *queue) {
+		q.dedupKey = key
+	}
+}
+
+func (d *dedup) push(e element) bool {
+	k := d.key(e.data)
+
+	queued, found := d.keys[k]
+	if found && e.priority <= queued.priority {
+		return false
+	}
+	if !d.store.push(e) {
+		return false
+	}
+
+	if found {
+		// the queued element may still be held until it becomes visible
+		if removed := d.store.remove(func(r element) bool { return r.seq == queued.seq }, 1); len(removed) == 0 {
+			_ = d.held.drop(queued.seq)
+		}
+	}
+	d.keys[k] = e
+	return true
+}
+
+func (d *dedup) pop() (element, bool) {
+	return d.forget(d.store.pop())
+}
+
+func (d *dedup) popPriority(priority QueuePriority) (element, bool) {
+	return d.forget(d.store.popPriority(priority))
+}
+
+func (d *dedup) evict(policy OverflowPolicy, priority QueuePriority) (element, bool) {
+	return d.forget(d.store.evict(policy, priority))
+}
+
+func (d *dedup) remove(match func(e element) bool, limit int) []element {
+	removed := d.store.remove(match, limit)
+
+	for _, e := range removed {
+		_, _ = d.forget(e, true)
+	}
+	return removed
+}
+
+func (d *dedup) compact() {
+	d.store.compact()
+	// a map never releases its buckets, so the keys move to a new one
+	d.keys = maps.Clone(d.keys)
+}
+
+func (d *dedup) clear() {
+	d.store.clear()
+	clear(d.keys)
+}
+
+// forget releases the key of an element that has left the store.
+func (d *dedup) forget(e element, ok bool) (element, bool) {
+	if ok {
+		delete(d.keys, d.key(e.data))
+	}
+	return e, ok
+}
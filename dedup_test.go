@@ -0,0 +1,73 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "testing"
+
+func TestDedupQueue(t *testing.T) {
+	type job struct {
+		id   string
+		note string
+	}
+
+	q := NewDedupQueue(func(data any) string { return data.(*job).id })
+
+	q.AppendPriority(&job{id: "a", note: "first"}, PriorityNormal)
+	q.AppendPriority(&job{id: "a", note: "duplicate"}, PriorityNormal)
+	q.AppendPriority(&job{id: "a", note: "lower"}, PriorityLow)
+	q.AppendPriority(&job{id: "b", note: "first"}, PriorityNormal)
+	if l := q.Len(); l != 2 {
+		t.Errorf("expected duplicates to be discarded leaving 2 elements, got %d", l)
+	}
+
+	// The higher priority copy replaces the queued element
+	if !q.TryAppend(&job{id: "b", note: "upgraded"}, PriorityCritical) {
+		t.Errorf("the higher priority copy was rejected")
+	}
+	if l := q.LenPriority(PriorityCritical); l != 1 || q.Len() != 2 {
+		t.Errorf("the upgraded element was not moved to PriorityCritical")
+	}
+
+	expected := []string{"b:upgraded", "a:first"}
+	for _, want := range expected {
+		e, _ := q.Next()
+		if have := e.(*job).id + ":" + e.(*job).note; have != want {
+			t.Errorf("expected '%s' but got '%s'", want, have)
+		}
+	}
+
+	// Keys are released once their element leaves the Queue
+	q.Append(&job{id: "a", note: "again"})
+	if l := q.Len(); l != 1 {
+		t.Errorf("a key was not released after its element left the Queue")
+	}
+	q.Clear()
+	q.Append(&job{id: "a", note: "cleared"})
+	if l := q.Len(); l != 1 {
+		t.Errorf("a key was not released after the Queue was cleared")
+	}
+}
+
+func TestDedupUpdatePriority(t *testing.T) {
+	q := NewQueue(WithDedup(func(data any) string { return data.(string) }))
+
+	q.Append("a")
+	q.Append("b")
+	if !q.UpdatePriority("a", PriorityLow) {
+		t.Errorf("UpdatePriority failed to demote the element")
+	}
+	if !q.UpdatePriority("b", PriorityNormal) {
+		t.Errorf("UpdatePriority failed to move the element within its level")
+	}
+	if l := q.Len(); l != 2 {
+		t.Errorf("expected 2 elements after the moves, got %d", l)
+	}
+
+	for _, want := range []string{"b", "a"} {
+		if have, ok := q.Next(); !ok || have.(string) != want {
+			t.Errorf("expected '%s' but got '%v'", want, have)
+		}
+	}
+}
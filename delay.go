@@ -0,0 +1,266 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"container/heap"
+	"slices"
+	"time"
+	"unsafe"
+)
+
+// DelayQueue is a Queue that can hold data until it becomes visible at a future moment.
+type DelayQueue interface {
+	Queue
+
+	// AppendDelayed adds the data to the DelayQueue with respect to priority, but the data
+	// is not returned by Next or Peek, or counted by Len, until visibleAt has passed. The data
+	// held until then counts against the capacity set using WithCapacity, and is discarded
+	// when the DelayQueue is full, whatever the overflow policy, since it cannot take the place
+	// of visible data. Its key is known to WithDedup from the moment it is appended.
+	AppendDelayed(data any, priority QueuePriority, visibleAt time.Time)
+
+	// LenDelayed returns the number of elements that are not yet visible.
+	LenDelayed() int
+}
+
+type delayQueue struct {
+	*queue
+	delayed *delayed
+	timer   *time.Timer
+}
+
+// NewDelayQueue returns an initialized DelayQueue. The signal channel is asserted
+// by an internal timer once the earliest delayed element becomes visible.
+func NewDelayQueue(opts ...Option) DelayQueue {
+	q := newQueue(newLevels(numLevels))
+
+	// the store wrapped by configure holds the delayed elements, so the
+	// other options apply to them from the moment they are appended
+	d := &delayed{}
+	q.held = d
+	q.configure(opts)
+
+	dq := &delayQueue{queue: q, delayed: d}
+	dq.timer = time.AfterFunc(time.Hour, dq.wake)
+	dq.timer.Stop()
+	return dq
+}
+
+// AppendDelayed implements the DelayQueue interface.
+func (dq *delayQueue) AppendDelayed(data any, priority QueuePriority, visibleAt time.Time) {
+	dq.Lock()
+	defer dq.unlock()
+
+	if dq.closed {
+		return
+	}
+
+	data, priority, keep := dq.intercept(data, priority)
+	if !keep {
+		return
+	}
+	if visibleAt.After(time.Now()) && (dq.full() || dq.levelFull(dq.store.fit(priority))) {
+		return
+	}
+
+	dq.delayed.until = visibleAt
+	pushed := dq.pushElement(element{data: data, priority: priority}, dq.stamp())
+	dq.delayed.until = time.Time{}
+	if pushed {
+		dq.syncSignal()
+		dq.schedule()
+	}
+}
+
+// LenDelayed implements the DelayQueue interface.
+func (dq *delayQueue) LenDelayed() int {
+	dq.Lock()
+	defer dq.Unlock()
+
+	dq.delayed.promote()
+	return len(dq.delayed.pending)
+}
+
+// wake is called by the timer once the earliest delayed element should be visible.
+func (dq *delayQueue) wake() {
+	dq.Lock()
+	defer dq.unlock()
+
+	dq.delayed.promote()
+	dq.syncSignal()
+	dq.schedule()
+}
+
+// schedule sets the timer for the earliest delayed element.
+func (dq *delayQueue) schedule() {
+	if len(dq.delayed.pending) > 0 {
+		dq.timer.Reset(time.Until(dq.delayed.pending[0].visible))
+	}
+}
+
+// delayed wraps a store to hold elements until they become visible. Each
+// operation first moves the elements that have become visible into the store.
+type delayed struct {
+	store
+	pending pendingHeap
+	// until is the time the element being appended by AppendDelayed becomes visible
+	until time.Time
+}
+
+// waiting is an element held until it becomes visible.
+type waiting struct {
+	e       element
+	visible time.Time
+}
+
+func (d *delayed) push(e element) bool {
+	if d.until.After(time.Now()) {
+		d.hold(e, d.until)
+		return true
+	}
+	return d.store.push(e)
+}
+
+// hold keeps the element from the store until visible.
+func (d *delayed) hold(e element, visible time.Time) {
+	heap.Push(&d.pending, waiting{e: e, visible: visible})
+}
+
+// promote moves the elements that have become visible into the store.
+func (d *delayed) promote() {
+	if len(d.pending) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for len(d.pending) > 0 && !d.pending[0].visible.After(now) {
+		_ = d.store.push(heap.Pop(&d.pending).(waiting).e)
+	}
+}
+
+// visible returns a channel receiving once the earliest held element becomes visible,
+// or nil when no element is held.
+func (d *delayed) visible() <-chan time.Time {
+	if d == nil || len(d.pending) == 0 {
+		return nil
+	}
+	return time.After(time.Until(d.pending[0].visible))
+}
+
+func (d *delayed) pop() (element, bool) {
+	d.promote()
+	return d.store.pop()
+}
+
+func (d *delayed) peek() (element, bool) {
+	d.promote()
+	return d.store.peek()
+}
+
+func (d *delayed) popPriority(priority QueuePriority) (element, bool) {
+	d.promote()
+	return d.store.popPriority(priority)
+}
+
+func (d *delayed) peekPriority(priority QueuePriority) (element, bool) {
+	d.promote()
+	return d.store.peekPriority(priority)
+}
+
+func (d *delayed) len() int {
+	d.promote()
+	return d.store.len()
+}
+
+func (d *delayed) lenPriority(priority QueuePriority) int {
+	d.promote()
+	return d.store.lenPriority(priority)
+}
+
+func (d *delayed) eachLevel(fn func(priority QueuePriority, n int)) {
+	d.promote()
+	d.store.eachLevel(fn)
+}
+
+func (d *delayed) evict(policy OverflowPolicy, priority QueuePriority) (element, bool) {
+	d.promote()
+	return d.store.evict(policy, priority)
+}
+
+func (d *delayed) walk(fn func(e element) bool) {
+	d.promote()
+	d.store.walk(fn)
+}
+
+func (d *delayed) remove(match func(e element) bool, limit int) []element {
+	d.promote()
+	return d.store.remove(match, limit)
+}
+
+// drop removes the held element with the sequence number, and returns true when found.
+func (d *delayed) drop(seq uint64) bool {
+	if d != nil {
+		for i, w := range d.pending {
+			if w.e.seq == seq {
+				heap.Remove(&d.pending, i)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *delayed) clear() {
+	d.store.clear()
+	d.pending = nil
+}
+
+func (d *delayed) footprint() int {
+	return d.store.footprint() + cap(d.pending)*waitingSize
+}
+
+func (d *delayed) compact() {
+	d.store.compact()
+	switch {
+	case len(d.pending) == 0:
+		d.pending = nil
+	case cap(d.pending) > len(d.pending):
+		d.pending = slices.Clone(d.pending)
+	}
+}
+
+// waitingSize is the memory used by each element held until it becomes visible.
+const waitingSize = int(unsafe.Sizeof(waiting{}))
+
+// pendingHeap orders the delayed elements by the time they become visible.
+type pendingHeap []waiting
+
+// Len implements the heap.Interface.
+func (p pendingHeap) Len() int { return len(p) }
+
+// Less implements the heap.Interface.
+func (p pendingHeap) Less(i, j int) bool {
+	if !p[i].visible.Equal(p[j].visible) {
+		return p[i].visible.Before(p[j].visible)
+	}
+	return p[i].e.seq < p[j].e.seq
+}
+
+// Swap implements the heap.Interface.
+func (p pendingHeap) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+// Push implements the heap.Interface.
+func (p *pendingHeap) Push(x any) { *p = append(*p, x.(waiting)) }
+
+// Pop implements the heap.Interface.
+func (p *pendingHeap) Pop() any {
+	old := *p
+	last := len(old) - 1
+	w := old[last]
+	old[last] = waiting{} // prevent memory leak
+	*p = old[:last]
+	return w
+}
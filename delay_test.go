@@ -0,0 +1,121 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue(t *testing.T) {
+	q := NewDelayQueue()
+	now := time.Now()
+
+	q.AppendDelayed("later", PriorityCritical, now.Add(100*time.Millisecond))
+	q.AppendDelayed("soon", PriorityLow, now.Add(30*time.Millisecond))
+	q.AppendDelayed("past", PriorityLow, now.Add(-time.Second))
+	q.Append("now")
+	if l, d := q.Len(), q.LenDelayed(); l != 2 || d != 2 {
+		t.Errorf("expected 2 visible and 2 delayed elements, got %d and %d", l, d)
+	}
+	if e, _ := q.Peek(); e.(string) != "now" {
+		t.Errorf("Peek returned '%s' instead of the visible front", e.(string))
+	}
+
+	for _, want := range []string{"now", "past"} {
+		if have, _ := q.Next(); have.(string) != want {
+			t.Errorf("expected '%s' but got '%v'", want, have)
+		}
+	}
+	if _, ok := q.Next(); ok {
+		t.Errorf("a delayed element was returned before it became visible")
+	}
+
+	// The signal must be asserted by the timer as each delayed element becomes due
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	for _, want := range []string{"soon", "later"} {
+		select {
+		case <-q.Signal():
+			if have, ok := q.Next(); !ok || have.(string) != want {
+				t.Errorf("expected '%s' but got '%v'", want, have)
+			}
+		case <-timer.C:
+			t.Fatalf("the signal was not asserted when '%s' became visible", want)
+		}
+	}
+	if time.Since(now) < 100*time.Millisecond {
+		t.Errorf("the delayed elements were returned before becoming visible")
+	}
+	if !q.Empty() || q.LenDelayed() != 0 {
+		t.Errorf("expected the queue to be empty after popping inserted elements")
+	}
+}
+
+func TestDelayQueueClose(t *testing.T) {
+	q := NewDelayQueue()
+
+	q.AppendDelayed("delayed", PriorityNormal, time.Now().Add(30*time.Millisecond))
+	q.Close()
+	if _, _, err := q.NextContext(context.Background()); err != nil {
+		t.Errorf("NextContext returned %v while data was still delayed", err)
+	}
+	if _, _, err := q.NextContext(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed once the delayed data was removed, got %v", err)
+	}
+
+	q = NewDelayQueue()
+	q.AppendDelayed("channel", PriorityNormal, time.Now().Add(30*time.Millisecond))
+	q.Close()
+	if data, ok := <-q.Channel(); !ok || data.(string) != "channel" {
+		t.Errorf("the channel was closed before the delayed data became visible")
+	}
+	if _, ok := <-q.Channel(); ok {
+		t.Errorf("the channel was not closed once the Queue was drained")
+	}
+
+	q = NewDelayQueue()
+	q.AppendDelayed("consumed", PriorityNormal, time.Now().Add(30*time.Millisecond))
+	q.Close()
+	var consumed []any
+	q.Consume(nil, func(data any) {
+		consumed = append(consumed, data)
+	})
+	if len(consumed) != 1 {
+		t.Errorf("Consume returned before the delayed data became visible")
+	}
+}
+
+func TestDelayQueueOptions(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+
+	q := NewDelayQueue(WithCapacity(2))
+	for i := 0; i < 5; i++ {
+		q.AppendDelayed(i, PriorityNormal, later)
+	}
+	if d := q.LenDelayed(); d != 2 {
+		t.Errorf("expected the delayed data to be bounded by the capacity of 2, got %d elements", d)
+	}
+	if !q.IsFull() || q.TryAppend("visible", PriorityNormal) {
+		t.Errorf("the delayed data did not count against the capacity")
+	}
+
+	q = NewDelayQueue(WithDedup(func(data any) string { return data.(string) }))
+	q.AppendDelayed("dup", PriorityNormal, later)
+	q.AppendDelayed("dup", PriorityNormal, later)
+	if d, appended := q.LenDelayed(), q.Stats().Appended; d != 1 || appended != 1 {
+		t.Errorf("expected the delayed duplicate to be rejected, got %d elements and %d appended", d, appended)
+	}
+	q.AppendDelayed("dup", PriorityHigh, later)
+	if d := q.LenDelayed(); d != 1 {
+		t.Errorf("expected the higher priority duplicate to replace the delayed element, got %d elements", d)
+	}
+	q.Append("dup")
+	if l := q.Len(); l != 0 {
+		t.Errorf("the key of the delayed element was not known, got %d visible elements", l)
+	}
+}
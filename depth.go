@@ -0,0 +1,77 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "time"
+
+// maxDepthSamples is the number of recent samples kept by WithDepthSampling.
+const maxDepthSamples = 128
+
+// WithDepthSampling records the length of the Queue each time interval passes, keeping the
+// most recent samples for DepthSamples. The sampling stops once the Queue is closed. An
+// interval of zero or less disables the sampling.
+func WithDepthSampling(interval time.Duration) Option {
+	return func(q *queue) {
+		if interval > 0 {
+			q.depth = &depthSamples{interval: interval}
+		}
+	}
+}
+
+// depthSamples is a ring of the most recent lengths recorded by the sampler timer.
+type depthSamples struct {
+	interval time.Duration
+	timer    *time.Timer
+	samples  []int
+	next     int
+}
+
+// DepthSamples implements the Queue interface.
+func (q *queue) DepthSamples() []int {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.depth == nil {
+		return []int{}
+	}
+
+	d := q.depth
+	results := make([]int, 0, len(d.samples))
+	// the oldest sample is overwritten next once the ring is full
+	results = append(results, d.samples[d.next:]...)
+	return append(results, d.samples[:d.next]...)
+}
+
+// startSampling schedules the first sample of the depth.
+func (q *queue) startSampling() {
+	if q.depth != nil {
+		q.depth.timer = time.AfterFunc(q.depth.interval, q.sampleDepth)
+	}
+}
+
+// sampleDepth is called by the sampler timer to record the length of the Queue.
+func (q *queue) sampleDepth() {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.closed {
+		return
+	}
+
+	d := q.depth
+	if len(d.samples) < maxDepthSamples {
+		d.samples = append(d.samples, q.store.len())
+	} else {
+		d.samples[d.next] = q.store.len()
+		d.next = (d.next + 1) % maxDepthSamples
+	}
+	d.timer.Reset(d.interval)
+}
+
+func (q *queue) stopSampling() {
+	if q.depth != nil && q.depth.timer != nil {
+		q.depth.timer.Stop()
+	}
+}
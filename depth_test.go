@@ -0,0 +1,66 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithDepthSampling(t *testing.T) {
+	if s := NewQueue().DepthSamples(); s == nil || len(s) != 0 {
+		t.Errorf("a queue without sampling did not return an empty slice")
+	}
+
+	q := NewQueue(WithDepthSampling(5 * time.Millisecond))
+	q.AppendAll([]any{1, 2, 3}, PriorityNormal)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(q.DepthSamples()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the depth was not sampled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if s := q.DepthSamples(); s[len(s)-1] != 3 {
+		t.Errorf("expected the latest sample to be 3, got %d", s[len(s)-1])
+	}
+
+	q.Close()
+	n := len(q.DepthSamples())
+	time.Sleep(30 * time.Millisecond)
+	if m := len(q.DepthSamples()); m != n {
+		t.Errorf("the depth was sampled %d more times after Close", m-n)
+	}
+}
+
+func TestDepthSamplesRing(t *testing.T) {
+	q := NewQueue(WithDepthSampling(time.Hour))
+	defer q.Close()
+
+	raw := q.(*queue)
+	for i := 0; i < maxDepthSamples+2; i++ {
+		q.Append(i)
+		raw.sampleDepth()
+	}
+
+	s := q.DepthSamples()
+	if len(s) != maxDepthSamples {
+		t.Fatalf("expected %d samples to be kept, got %d", maxDepthSamples, len(s))
+	}
+	if s[0] != 3 || s[len(s)-1] != maxDepthSamples+2 {
+		t.Errorf("expected the samples from 3 to %d, got %d to %d", maxDepthSamples+2, s[0], s[len(s)-1])
+	}
+
+	q.Reset()
+	if s := q.DepthSamples(); len(s) != 0 {
+		t.Errorf("expected Reset to discard the samples, got %d", len(s))
+	}
+	q.Append("after")
+	raw.sampleDepth()
+	if s := q.DepthSamples(); len(s) != 1 || s[0] != 1 {
+		t.Errorf("expected a single sample of 1 after Reset, got %v", s)
+	}
+}
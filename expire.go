@@ -0,0 +1,98 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "time"
+
+// WithItemTTL discards data that has waited on the Queue for longer than d. Expired data
+// is discarded when it reaches the front of the Queue, so it is never returned by Next or
+// Peek and never passed to a Process callback, but it is counted by Len until discarded.
+func WithItemTTL(d time.Duration) Option {
+	return func(q *queue) {
+		if d > 0 {
+			q.ttl = d
+			q.stamped = true
+		}
+	}
+}
+
+// OnExpire sets a function called with each element discarded by WithItemTTL.
+// The function is called while the lock is held and must not use the Queue.
+func OnExpire(fn func(any)) Option {
+	return func(q *queue) {
+		q.onExpire = fn
+	}
+}
+
+// expiring wraps a store to discard the elements that have outlived the TTL.
+type expiring struct {
+	store
+	ttl      time.Duration
+	onExpire func(any)
+	stamps   *sideTable[time.Time]
+	// trimmed is set once an element was discarded, until the signal is synced
+	trimmed bool
+}
+
+func (x *expiring) expired(e element, now time.Time) bool {
+	return now.Sub(x.stamps.get(e.id)) > x.ttl
+}
+
+func (x *expiring) discard(e element) {
+	x.trimmed = true
+	if x.onExpire != nil {
+		x.onExpire(e.data)
+	}
+}
+
+// trim discards expired elements from the front of the store.
+func (x *expiring) trim() {
+	now := time.Now()
+
+	for {
+		e, ok := x.store.peek()
+		if !ok || !x.expired(e, now) {
+			return
+		}
+
+		e, _ = x.store.pop()
+		x.discard(e)
+	}
+}
+
+// trimPriority discards expired elements from the front of the priority level.
+func (x *expiring) trimPriority(priority QueuePriority) {
+	now := time.Now()
+
+	for {
+		e, ok := x.store.peekPriority(priority)
+		if !ok || !x.expired(e, now) {
+			return
+		}
+
+		e, _ = x.store.popPriority(priority)
+		x.discard(e)
+	}
+}
+
+func (x *expiring) pop() (element, bool) {
+	x.trim()
+	return x.store.pop()
+}
+
+func (x *expiring) peek() (element, bool) {
+	x.trim()
+	return x.store.peek()
+}
+
+func (x *expiring) popPriority(priority QueuePriority) (element, bool) {
+	x.trimPriority(priority)
+	return x.store.popPriority(priority)
+}
+
+func (x *expiring) peekPriority(priority QueuePriority) (element, bool) {
+	x.trimPriority(priority)
+	return x.store.peekPriority(priority)
+}
@@ -0,0 +1,71 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithItemTTL(t *testing.T) {
+	var expired []any
+	q := NewQueue(WithItemTTL(50*time.Millisecond), OnExpire(func(data any) {
+		expired = append(expired, data)
+	}))
+
+	q.AppendPriority("stale-crit", PriorityCritical)
+	q.AppendPriority("stale-low", PriorityLow)
+	time.Sleep(100 * time.Millisecond)
+	q.AppendPriority("fresh", PriorityNormal)
+
+	if e, ok := q.Peek(); !ok || e.(string) != "fresh" {
+		t.Errorf("Peek returned an expired element")
+	}
+
+	var processed []any
+	q.Process(func(data any) {
+		processed = append(processed, data)
+	})
+	if len(processed) != 1 || processed[0].(string) != "fresh" {
+		t.Errorf("expected only the fresh element to be processed, got %v", processed)
+	}
+	if len(expired) != 2 {
+		t.Errorf("expected the OnExpire hook to observe 2 elements, got %d", len(expired))
+	}
+	if !q.Empty() {
+		t.Errorf("expected the queue to be empty after processing")
+	}
+}
+
+func TestWithItemTTLDedup(t *testing.T) {
+	q := NewQueue(WithItemTTL(10*time.Millisecond), WithDedup(func(data any) string { return data.(string) }))
+
+	q.Append("a")
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := q.Next(); ok {
+		t.Errorf("Next returned an expired element")
+	}
+
+	q.Append("a")
+	if l := q.Len(); l != 1 {
+		t.Errorf("the key of an expired element was not released, got %d elements", l)
+	}
+}
+
+func TestWithItemTTLPeekSignal(t *testing.T) {
+	q := NewQueue(WithItemTTL(10 * time.Millisecond))
+
+	q.Append("a")
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := q.Peek(); ok {
+		t.Errorf("Peek returned an expired element")
+	}
+
+	select {
+	case <-q.Signal():
+		t.Errorf("the signal remained asserted once Peek discarded the expired element")
+	default:
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"container/heap"
+	"slices"
+)
+
+// heapStore stores elements in a binary heap ordered by the less function.
+type heapStore struct {
+	elements []element
+	less     func(a, b element) bool
+	// counts holds the number of elements at each priority holding data
+	counts map[QueuePriority]int
+}
+
+// HeapQueue is a Queue stored in a binary heap, which accepts the full QueuePriority range.
+type HeapQueue interface {
+	Queue
+
+	// NextWithKey returns the data at the front of the HeapQueue along with the key ordering
+	// it. The key combines the negated priority in the high bits with the sequence number
+	// assigned when the data was appended in the low 40 bits, which keeps the data appended
+	// at a priority in FIFO order. The data is removed in ascending key order as long as the
+	// priorities are strictly between -2^23 and 2^23, and fewer than 2^40 elements have been
+	// appended since the HeapQueue was created or Reset. Beyond those ranges the keys
+	// overflow, or the sequence numbers wrap, so they no longer follow the removal order.
+	NextWithKey() (any, int64, bool)
+}
+
+type heapQueue struct {
+	*queue
+}
+
+// seqBits is the number of low bits of a HeapQueue key holding the sequence number.
+const seqBits = 40
+
+// NewHeapQueue returns an initialized HeapQueue that accepts the full QueuePriority range.
+// Data is served in strict priority order, highest first, and FIFO within a priority.
+func NewHeapQueue(opts ...Option) HeapQueue {
+	q := newQueue(newHeapStore(func(a, b element) bool {
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return a.seq < b.seq
+	}))
+
+	q.configure(opts)
+	return &heapQueue{queue: q}
+}
+
+// NextWithKey implements the HeapQueue interface.
+func (hq *heapQueue) NextWithKey() (any, int64, bool) {
+	hq.Lock()
+	defer hq.unlock()
+
+	e, ok := hq.next()
+	if !ok {
+		return nil, 0, false
+	}
+	return e.data, -int64(e.priority)<<seqBits + int64(e.seq&(1<<seqBits-1)), true
+}
+
+// NewQueueFunc returns an initialized Queue that serves the data in the order defined
+// by less, so Next always returns the smallest element. The priority levels provided
+// to AppendPriority are ignored for ordering, and ties are served in FIFO order.
+func NewQueueFunc(less func(a, b any) bool, opts ...Option) Queue {
+	q := newQueue(newHeapStore(func(a, b element) bool {
+		if less(a.data, b.data) {
+			return true
+		} else if less(b.data, a.data) {
+			return false
+		}
+		return a.seq < b.seq
+	}))
+
+	q.configure(opts)
+	return q
+}
+
+func newHeapStore(less func(a, b element) bool) *heapStore {
+	return &heapStore{less: less, counts: make(map[QueuePriority]int)}
+}
+
+// Len implements the heap.Interface.
+func (h *heapStore) Len() int { return len(h.elements) }
+
+// Less implements the heap.Interface.
+func (h *heapStore) Less(i, j int) bool { return h.less(h.elements[i], h.elements[j]) }
+
+// Swap implements the heap.Interface.
+func (h *heapStore) Swap(i, j int) { h.elements[i], h.elements[j] = h.elements[j], h.elements[i] }
+
+// Push implements the heap.Interface.
+func (h *heapStore) Push(x any) {
+	e := x.(element)
+	h.elements = append(h.elements, e)
+	h.count(e.priority, 1)
+}
+
+// Pop implements the heap.Interface.
+func (h *heapStore) Pop() any {
+	last := len(h.elements) - 1
+	e := h.elements[last]
+	h.elements[last] = element{} // prevent memory leak
+	h.elements = h.elements[:last]
+	h.count(e.priority, -1)
+	return e
+}
+
+// count adds n to the number of elements at the priority.
+func (h *heapStore) count(priority QueuePriority, n int) {
+	if h.counts[priority] += n; h.counts[priority] == 0 {
+		delete(h.counts, priority)
+	}
+}
+
+// fit keeps the priority, since the heap accepts the full QueuePriority range.
+func (h *heapStore) fit(priority QueuePriority) QueuePriority {
+	return priority
+}
+
+func (h *heapStore) push(e element) bool {
+	heap.Push(h, e)
+	return true
+}
+
+func (h *heapStore) pop() (element, bool) {
+	if len(h.elements) == 0 {
+		return element{}, false
+	}
+	return heap.Pop(h).(element), true
+}
+
+func (h *heapStore) peek() (element, bool) {
+	if len(h.elements) == 0 {
+		return element{}, false
+	}
+	return h.elements[0], true
+}
+
+func (h *heapStore) evict(policy OverflowPolicy, priority QueuePriority) (element, bool) {
+	idx := -1
+
+	for i, e := range h.elements {
+		if idx < 0 {
+			idx = i
+			continue
+		}
+
+		cur := h.elements[idx]
+		if policy == EvictOldestLow && e.priority != cur.priority {
+			if e.priority < cur.priority {
+				idx = i
+			}
+		} else if e.seq < cur.seq {
+			idx = i
+		}
+	}
+
+	if idx < 0 || (policy == EvictOldestLow && priority < h.elements[idx].priority) {
+		return element{}, false
+	}
+	return heap.Remove(h, idx).(element), true
+}
+
+func (h *heapStore) popPriority(priority QueuePriority) (element, bool) {
+	if idx := h.frontPriority(priority); idx >= 0 {
+		return heap.Remove(h, idx).(element), true
+	}
+	return element{}, false
+}
+
+func (h *heapStore) peekPriority(priority QueuePriority) (element, bool) {
+	if idx := h.frontPriority(priority); idx >= 0 {
+		return h.elements[idx], true
+	}
+	return element{}, false
+}
+
+// frontPriority returns the index of the element served next at the priority, or -1.
+func (h *heapStore) frontPriority(priority QueuePriority) int {
+	idx := -1
+	if h.counts[priority] == 0 {
+		return idx
+	}
+
+	for i, e := range h.elements {
+		if e.priority == priority && (idx < 0 || h.less(e, h.elements[idx])) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+func (h *heapStore) len() int {
+	return len(h.elements)
+}
+
+func (h *heapStore) lenPriority(priority QueuePriority) int {
+	return h.counts[priority]
+}
+
+func (h *heapStore) remove(match func(e element) bool, limit int) []element {
+	var removed []element
+	seqs := make(map[uint64]struct{})
+
+	h.walk(func(e element) bool {
+		if match(e) {
+			removed = append(removed, e)
+			seqs[e.seq] = struct{}{}
+		}
+		return limit < 1 || len(removed) < limit
+	})
+
+	if len(removed) > 0 {
+		h.elements = slices.DeleteFunc(h.elements, func(e element) bool {
+			_, found := seqs[e.seq]
+			return found
+		})
+		for _, e := range removed {
+			h.count(e.priority, -1)
+		}
+		heap.Init(h)
+	}
+	return removed
+}
+
+func (h *heapStore) walk(fn func(e element) bool) {
+	for _, e := range h.sorted() {
+		if !fn(e) {
+			return
+		}
+	}
+}
+
+// sorted returns a copy of the elements in the order they will be served.
+func (h *heapStore) sorted() []element {
+	sorted := slices.Clone(h.elements)
+	slices.SortFunc(sorted, func(a, b element) int {
+		if h.less(a, b) {
+			return -1
+		} else if h.less(b, a) {
+			return 1
+		}
+		return 0
+	})
+	return sorted
+}
+
+func (h *heapStore) footprint() int {
+	return cap(h.elements) * elementSize
+}
+
+func (h *heapStore) empty() store {
+	return newHeapStore(h.less)
+}
+
+func (h *heapStore) clear() {
+	h.elements = nil
+	clear(h.counts)
+}
+
+// eachLevel reports the four named levels, along with each other priority holding data.
+func (h *heapStore) eachLevel(fn func(priority QueuePriority, n int)) {
+	for p := PriorityLow; p <= PriorityCritical; p++ {
+		fn(p, h.counts[p])
+	}
+	for p, n := range h.counts {
+		if p < PriorityLow || p > PriorityCritical {
+			fn(p, n)
+		}
+	}
+}
+
+func (h *heapStore) compact() {
+	switch {
+	case len(h.elements) == 0:
+		h.elements = nil
+	case cap(h.elements) > len(h.elements):
+		h.elements = slices.Clone(h.elements)
+	}
+}
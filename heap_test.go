@@ -0,0 +1,147 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeapQueue(t *testing.T) {
+	q := NewHeapQueue()
+
+	q.AppendPriority("p5a", 5)
+	q.AppendPriority("p-1", -1)
+	q.AppendPriority("p100", 100)
+	q.AppendPriority("p5b", 5)
+	q.Append("normal")
+	q.AppendPriority("p5c", 5)
+	if l := q.LenPriority(5); l != 3 {
+		t.Errorf("expected 3 elements at priority 5, got %d", l)
+	}
+	if e, ok := q.PeekPriority(5); !ok || e.(string) != "p5a" {
+		t.Errorf("PeekPriority did not return the front of priority 5")
+	}
+	if e, ok := q.NextPriority(-1); !ok || e.(string) != "p-1" {
+		t.Errorf("NextPriority did not return the element at priority -1")
+	}
+	q.AppendPriority("p-1", -1)
+
+	expected := []string{"p100", "p5a", "p5b", "p5c", "normal", "p-1"}
+	for _, want := range expected {
+		if e, _ := q.Peek(); e.(string) != want {
+			t.Errorf("Peek returned '%s' instead of '%s'", e.(string), want)
+		}
+		if have, _ := q.Next(); have.(string) != want {
+			t.Errorf("element popped out of priority order, expected '%s' but got '%s'", want, have)
+		}
+	}
+	if !q.Empty() {
+		t.Errorf("expected the queue to be empty after popping inserted elements, but it still has %d elements", q.Len())
+	}
+
+	q.AppendPriority("b", 1)
+	q.AppendPriority("a", 2)
+	if e := q.DrainAll(); len(e) != 2 || e[0].(string) != "a" || e[1].(string) != "b" {
+		t.Errorf("DrainAll returned the elements out of priority order: %v", e)
+	}
+}
+
+func TestNextWithKey(t *testing.T) {
+	q := NewHeapQueue()
+
+	q.AppendPriority("p5a", 5)
+	q.AppendPriority("p-1", -1)
+	q.AppendPriority("p100", 100)
+	q.AppendPriority("p5b", 5)
+
+	var last int64
+	for i, want := range []string{"p100", "p5a", "p5b", "p-1"} {
+		data, key, ok := q.NextWithKey()
+		if !ok || data != want {
+			t.Fatalf("expected '%s' but got '%v'", want, data)
+		}
+		if i > 0 && key <= last {
+			t.Errorf("the key %d of '%s' does not follow the key %d of the previous element", key, want, last)
+		}
+		last = key
+	}
+	if _, _, ok := q.NextWithKey(); ok {
+		t.Errorf("NextWithKey returned data from an empty queue")
+	}
+
+	q.AppendPriority("p5c", 5)
+	if _, key, _ := q.NextWithKey(); key != -5<<seqBits+5 {
+		t.Errorf("expected the key of priority 5 and sequence 5, got %d", key)
+	}
+}
+
+func TestHeapQueueCounts(t *testing.T) {
+	m := newTestMetrics()
+	q := NewHeapQueue(WithMetrics(m))
+
+	q.AppendPriority("p100", 100)
+	q.AppendPriority("p-1", -1)
+	q.Append("normal")
+
+	counts, stats := q.CountByPriority(), q.Stats()
+	for _, p := range []QueuePriority{100, -1, PriorityNormal} {
+		if counts[p] != 1 || stats.LenPriority[p] != 1 || m.depth[p] != 1 {
+			t.Errorf("expected one element reported at priority %d, got %d, %d and %d", p, counts[p], stats.LenPriority[p], m.depth[p])
+		}
+	}
+	if _, found := counts[PriorityCritical]; !found {
+		t.Errorf("the named levels without data were not reported")
+	}
+
+	_, _ = q.Next()
+	if _, found := q.CountByPriority()[100]; found || m.depth[100] != 0 {
+		t.Errorf("the priority 100 was still reported holding data once emptied")
+	}
+
+	// the counts follow the data removed without being dequeued
+	q.AppendPriority("p7", 7)
+	q.AppendPriority("p7", 7)
+	q.Remove("p7")
+	if l := q.LenPriority(7); l != 1 {
+		t.Errorf("expected one element at priority 7 after the removal, got %d", l)
+	}
+	q.Clear()
+	if l := q.LenPriority(-1); l != 0 || len(q.CountByPriority()) != numLevels {
+		t.Errorf("the counts of the priorities were kept once the HeapQueue was cleared")
+	}
+}
+
+func TestQueueFunc(t *testing.T) {
+	type job struct {
+		name     string
+		deadline time.Time
+	}
+
+	q := NewQueueFunc(func(a, b any) bool {
+		return a.(*job).deadline.Before(b.(*job).deadline)
+	})
+
+	now := time.Now()
+	q.AppendPriority(&job{name: "later", deadline: now.Add(time.Hour)}, PriorityCritical)
+	q.Append(&job{name: "soon1", deadline: now.Add(time.Minute)})
+	q.Append(&job{name: "soonest", deadline: now})
+	q.AppendPriority(&job{name: "soon2", deadline: now.Add(time.Minute)}, PriorityLow)
+
+	select {
+	case <-q.Signal():
+	default:
+		t.Errorf("the signal was not asserted after appending elements")
+	}
+
+	for _, want := range []string{"soonest", "soon1", "soon2", "later"} {
+		if have, _ := q.Next(); have.(*job).name != want {
+			t.Errorf("element popped out of comparator order, expected '%s' but got '%s'", want, have.(*job).name)
+		}
+	}
+	if _, ok := q.Next(); ok {
+		t.Errorf("an empty Queue claimed to return another element")
+	}
+}
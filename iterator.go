@@ -0,0 +1,41 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+// QueueIterator steps through the data copied from a Queue by Iterator.
+type QueueIterator interface {
+	// HasNext returns true when Next has more data to return.
+	HasNext() bool
+
+	// Next returns the following data, or nil once the data has been exhausted.
+	Next() any
+}
+
+type iterator struct {
+	data []any
+	pos  int
+}
+
+// Iterator implements the Queue interface.
+func (q *queue) Iterator() QueueIterator {
+	return &iterator{data: q.Snapshot()}
+}
+
+// HasNext implements the QueueIterator interface.
+func (it *iterator) HasNext() bool {
+	return it.pos < len(it.data)
+}
+
+// Next implements the QueueIterator interface.
+func (it *iterator) Next() any {
+	if !it.HasNext() {
+		return nil
+	}
+
+	data := it.data[it.pos]
+	it.data[it.pos] = nil // release the data once returned
+	it.pos++
+	return data
+}
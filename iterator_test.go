@@ -0,0 +1,39 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "testing"
+
+func TestIterator(t *testing.T) {
+	q := NewQueue()
+
+	if it := q.Iterator(); it.HasNext() || it.Next() != nil {
+		t.Errorf("the iterator of an empty queue returned data")
+	}
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("high", PriorityHigh)
+	q.Append("normal")
+
+	it := q.Iterator()
+	// changes made after Iterator are not seen by the iterator
+	q.Append("late")
+	_, _ = q.Next()
+
+	for _, want := range []string{"high", "normal", "low"} {
+		if !it.HasNext() {
+			t.Fatalf("the iterator was exhausted before '%s'", want)
+		}
+		if have := it.Next(); have != want {
+			t.Errorf("expected '%s' but got '%v'", want, have)
+		}
+	}
+	if it.HasNext() || it.Next() != nil {
+		t.Errorf("the iterator returned data after it was exhausted")
+	}
+	if l := q.Len(); l != 3 {
+		t.Errorf("expected iterating to leave 3 elements on the queue, got %d", l)
+	}
+}
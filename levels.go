@@ -0,0 +1,538 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"slices"
+	"time"
+)
+
+// levels stores elements in a FIFO ring for each of the priority levels.
+type levels struct {
+	levels []ring
+	// top is the highest priority level
+	top QueuePriority
+	// weights and credits are only allocated for weighted round-robin queues
+	weights []int
+	credits []int
+	aging   time.Duration
+	// stamps holds the enqueue time of the elements, which aging requires
+	stamps *sideTable[time.Time]
+	// lifo serves each level from the back instead of the front
+	lifo bool
+}
+
+// newLevels returns levels holding n priority levels, numbered from zero.
+func newLevels(n int) *levels {
+	n = max(1, n)
+
+	return &levels{
+		levels: make([]ring, n),
+		top:    QueuePriority(n - 1),
+	}
+}
+
+// NewQueueLevels returns an initialized Queue holding n priority levels numbered from zero to
+// n-1, where a higher number is a higher priority, instead of the four named levels. Data is
+// appended using AppendPriority with a QueuePriority in that range, and invalid priorities
+// are appended at the nearest level. The options are those accepted by NewQueue. An n less
+// than one holds a single level.
+func NewQueueLevels(n int, opts ...Option) Queue {
+	q := newQueue(newLevels(n))
+
+	q.configure(opts)
+	return q
+}
+
+// NewWeightedQueue returns an initialized Queue that serves the priority levels using
+// weighted round-robin scheduling, which is the same as using NewQueue with WithWeights.
+func NewWeightedQueue(weights map[QueuePriority]int, opts ...Option) Queue {
+	return NewQueue(append([]Option{WithWeights(weights)}, opts...)...)
+}
+
+// WithWeights serves the priority levels using weighted round-robin scheduling instead of
+// strict priority. During each round, a level is served as many times as its weight, highest
+// priority first, before the next round begins. Empty levels are skipped and the round starts
+// over once every level holding data has used its weight, so no weight is wasted on levels
+// without data. Levels missing from weights, or given a weight less than one, receive a
+// weight of one. The option has no effect on a Queue that does not store its data in
+// priority levels.
+func WithWeights(weights map[QueuePriority]int) Option {
+	return func(q *queue) {
+		l, ok := q.store.(*levels)
+		if !ok {
+			return
+		}
+
+		l.weights = make([]int, len(l.levels))
+		l.credits = make([]int, len(l.levels))
+		for i := range l.weights {
+			l.weights[i] = max(1, weights[QueuePriority(i)])
+		}
+		copy(l.credits, l.weights)
+	}
+}
+
+func (l *levels) level(priority QueuePriority) *ring {
+	if priority < 0 || priority > l.top {
+		return nil
+	}
+	return &l.levels[priority]
+}
+
+func (l *levels) fit(priority QueuePriority) QueuePriority {
+	return min(max(priority, 0), l.top)
+}
+
+func (l *levels) eachLevel(fn func(priority QueuePriority, n int)) {
+	for p := range l.levels {
+		fn(QueuePriority(p), l.levels[p].len())
+	}
+}
+
+func (l *levels) push(e element) bool {
+	level := l.level(e.priority)
+	if level == nil {
+		return false
+	}
+
+	level.push(e)
+	return true
+}
+
+func (l *levels) pop() (element, bool) {
+	if l.strict() {
+		p, ok := l.highest()
+		if !ok {
+			return element{}, false
+		}
+		return l.take(&l.levels[p]), true
+	}
+
+	c := l.cursor(false)
+
+	p, ok := l.choose(&c)
+	if !ok {
+		return element{}, false
+	}
+
+	l.advance(&c, p)
+	return l.take(&l.levels[p]), true
+}
+
+func (l *levels) peek() (element, bool) {
+	if l.strict() {
+		p, ok := l.highest()
+		if !ok {
+			return element{}, false
+		}
+		return l.next(&l.levels[p], 0), true
+	}
+
+	c := l.cursor(false)
+
+	if p, ok := l.choose(&c); ok {
+		return l.next(&l.levels[p], 0), true
+	}
+	return element{}, false
+}
+
+func (l *levels) popPriority(priority QueuePriority) (element, bool) {
+	if level := l.level(priority); level != nil && level.len() > 0 {
+		return l.take(level), true
+	}
+	return element{}, false
+}
+
+func (l *levels) peekPriority(priority QueuePriority) (element, bool) {
+	if level := l.level(priority); level != nil && level.len() > 0 {
+		return l.next(level, 0), true
+	}
+	return element{}, false
+}
+
+// next returns the element at offset i from the end of the level that is served first.
+func (l *levels) next(r *ring, i int) element {
+	if l.lifo {
+		return r.at(r.len() - 1 - i)
+	}
+	return r.at(i)
+}
+
+// take removes and returns the element served first from the level, which must exist.
+func (l *levels) take(r *ring) element {
+	if l.lifo {
+		return r.popBack()
+	}
+	return r.pop()
+}
+
+// strict returns true when the levels are served in strict priority order, which allows
+// pop and peek to take the fast path of serving the highest level holding data.
+func (l *levels) strict() bool {
+	return l.credits == nil && l.aging == 0
+}
+
+// highest returns the highest priority level holding data.
+func (l *levels) highest() (QueuePriority, bool) {
+	for p := l.top; p >= 0; p-- {
+		if l.levels[p].len() > 0 {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// cursor is a position within the levels used to select the element served next,
+// which allows a walk to follow the dequeue order without modifying the levels. A
+// cursor without offsets stays at the front of each level.
+type cursor struct {
+	offsets []int
+	credits []int
+	now     time.Time
+}
+
+// cursor returns a cursor at the front of the levels. The cursor shares the weight credits
+// of the levels and has no offsets, unless detached is true, so pop and peek allocate nothing.
+func (l *levels) cursor(detached bool) cursor {
+	c := cursor{credits: l.credits}
+
+	if detached {
+		c.offsets = make([]int, len(l.levels))
+		c.credits = slices.Clone(l.credits)
+	}
+	if l.aging > 0 {
+		c.now = time.Now()
+	}
+	return c
+}
+
+// choose returns the priority level holding the element served next from the cursor.
+func (l *levels) choose(c *cursor) (QueuePriority, bool) {
+	if l.aging > 0 {
+		return l.chooseAged(c)
+	}
+	if c.credits != nil {
+		for p := l.top; p >= 0; p-- {
+			if l.remaining(c, p) > 0 && c.credits[p] > 0 {
+				return p, true
+			}
+		}
+	}
+
+	for p := l.top; p >= 0; p-- {
+		if l.remaining(c, p) > 0 {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// chooseAged selects the level whose next element has the highest effective priority.
+// Only the next element of each level is inspected, which is the oldest element at that
+// level, unless the levels are served in LIFO order.
+func (l *levels) chooseAged(c *cursor) (QueuePriority, bool) {
+	var found bool
+	var best, bestEffective QueuePriority
+	var bestStamp time.Time
+
+	for p := l.top; p >= 0; p-- {
+		if l.remaining(c, p) == 0 {
+			continue
+		}
+
+		stamp := l.stamps.get(l.next(&l.levels[p], c.offset(p)).id)
+		effective := l.top
+		if promoted := c.now.Sub(stamp) / l.aging; promoted < time.Duration(l.top-p) {
+			effective = p + QueuePriority(promoted)
+		}
+
+		if !found || effective > bestEffective || (effective == bestEffective && stamp.Before(bestStamp)) {
+			found = true
+			best = p
+			bestEffective = effective
+			bestStamp = stamp
+		}
+	}
+	return best, found
+}
+
+// advance moves the cursor past the element served from the priority level.
+func (l *levels) advance(c *cursor, p QueuePriority) {
+	if c.credits != nil {
+		if c.credits[p] == 0 {
+			// every level holding data has used its weight
+			copy(c.credits, l.weights)
+		}
+		c.credits[p]--
+	}
+	if c.offsets != nil {
+		c.offsets[p]++
+	}
+}
+
+func (l *levels) remaining(c *cursor, p QueuePriority) int {
+	return l.levels[p].len() - c.offset(p)
+}
+
+// offset returns the number of elements the cursor has moved past at the priority level.
+func (c *cursor) offset(p QueuePriority) int {
+	if c.offsets == nil {
+		return 0
+	}
+	return c.offsets[p]
+}
+
+func (l *levels) evict(policy OverflowPolicy, priority QueuePriority) (element, bool) {
+	oldest := -1
+
+	for p := QueuePriority(0); p <= l.top; p++ {
+		if l.levels[p].len() == 0 {
+			continue
+		}
+		if policy == EvictOldestLow {
+			if priority < p {
+				return element{}, false
+			}
+			return l.levels[p].pop(), true
+		}
+		if oldest < 0 || l.levels[p].front().seq < l.levels[oldest].front().seq {
+			oldest = int(p)
+		}
+	}
+
+	if oldest < 0 {
+		return element{}, false
+	}
+	return l.levels[oldest].pop(), true
+}
+
+func (l *levels) len() int {
+	var qlen int
+	for i := range l.levels {
+		qlen += l.levels[i].len()
+	}
+	return qlen
+}
+
+func (l *levels) lenPriority(priority QueuePriority) int {
+	if level := l.level(priority); level != nil {
+		return level.len()
+	}
+	return 0
+}
+
+func (l *levels) remove(match func(e element) bool, limit int) []element {
+	var removed []element
+	seqs := make(map[uint64]struct{})
+
+	l.walk(func(e element) bool {
+		if match(e) {
+			removed = append(removed, e)
+			seqs[e.seq] = struct{}{}
+		}
+		return limit < 1 || len(removed) < limit
+	})
+
+	if len(removed) > 0 {
+		for i := range l.levels {
+			l.levels[i].filter(func(e element) bool {
+				_, found := seqs[e.seq]
+				return !found
+			})
+		}
+	}
+	return removed
+}
+
+func (l *levels) walk(fn func(e element) bool) {
+	c := l.cursor(true)
+
+	for {
+		p, ok := l.choose(&c)
+		if !ok {
+			return
+		}
+
+		e := l.next(&l.levels[p], c.offsets[p])
+		l.advance(&c, p)
+		if !fn(e) {
+			return
+		}
+	}
+}
+
+func (l *levels) footprint() int {
+	var n int
+	for i := range l.levels {
+		n += len(l.levels[i].buf)
+	}
+	return n * elementSize
+}
+
+func (l *levels) empty() store {
+	return newLevels(len(l.levels))
+}
+
+func (l *levels) clear() {
+	for i := range l.levels {
+		l.levels[i].clear()
+	}
+	// the next round starts over
+	copy(l.credits, l.weights)
+}
+
+func (l *levels) compact() {
+	for i := range l.levels {
+		l.levels[i].compact()
+	}
+}
+
+// minRing is the smallest capacity allocated for a ring.
+const minRing = 16
+
+// ring is a circular FIFO of elements whose capacity is always a power of two. It grows by
+// doubling when full and shrinks by half when a quarter full, so enqueue and dequeue are
+// amortized O(1) and the memory retained tracks the number of live elements.
+type ring struct {
+	buf  []element
+	head int
+	size int
+	// reserved is the capacity retained regardless of the number of live elements
+	reserved int
+}
+
+// reserve allocates capacity for at least n elements and retains it from now on.
+func (r *ring) reserve(n int) {
+	if n < 1 {
+		return
+	}
+
+	r.reserved = minRing
+	for r.reserved < n {
+		r.reserved *= 2
+	}
+	if len(r.buf) < r.reserved {
+		r.resize(r.reserved)
+	}
+}
+
+func (r *ring) push(e element) {
+	if r.size == len(r.buf) {
+		r.resize(max(minRing, 2*len(r.buf)))
+	}
+
+	r.buf[(r.head+r.size)&(len(r.buf)-1)] = e
+	r.size++
+}
+
+// pop removes and returns the front element, which must exist.
+func (r *ring) pop() element {
+	e := r.buf[r.head]
+	r.buf[r.head] = element{} // prevent memory leak
+	r.head = (r.head + 1) & (len(r.buf) - 1)
+	r.size--
+
+	r.shrink()
+	return e
+}
+
+// popBack removes and returns the back element, which must exist.
+func (r *ring) popBack() element {
+	i := (r.head + r.size - 1) & (len(r.buf) - 1)
+	e := r.buf[i]
+	r.buf[i] = element{} // prevent memory leak
+	r.size--
+
+	r.shrink()
+	return e
+}
+
+// filter retains the elements for which keep returns true, preserving their order.
+func (r *ring) filter(keep func(e element) bool) {
+	var n int
+
+	for i := 0; i < r.size; i++ {
+		if e := r.at(i); keep(e) {
+			r.buf[(r.head+n)&(len(r.buf)-1)] = e
+			n++
+		}
+	}
+	for i := n; i < r.size; i++ {
+		r.buf[(r.head+i)&(len(r.buf)-1)] = element{} // prevent memory leak
+	}
+
+	r.size = n
+	r.shrink()
+}
+
+// shrink releases the buffer once empty and halves it once a quarter full,
+// without going below the reserved capacity.
+func (r *ring) shrink() {
+	if r.size == 0 && r.reserved == 0 {
+		r.clear()
+		return
+	}
+
+	for len(r.buf) > max(minRing, r.reserved) && r.size <= len(r.buf)/4 {
+		r.resize(len(r.buf) / 2)
+	}
+}
+
+// compact resizes the buffer to the smallest capacity holding the elements,
+// without going below the reserved capacity.
+func (r *ring) compact() {
+	if r.size == 0 && r.reserved == 0 {
+		r.clear()
+		return
+	}
+
+	n := max(minRing, r.reserved)
+	for n < r.size {
+		n *= 2
+	}
+	if n < len(r.buf) {
+		r.resize(n)
+	}
+}
+
+// resize moves the elements into a new buffer of capacity n, which must hold them.
+func (r *ring) resize(n int) {
+	buf := make([]element, n)
+
+	for i := 0; i < r.size; i++ {
+		buf[i] = r.at(i)
+	}
+	r.buf = buf
+	r.head = 0
+}
+
+// front returns the front element, which must exist.
+func (r *ring) front() element {
+	return r.buf[r.head]
+}
+
+// at returns the element at index i from the front.
+func (r *ring) at(i int) element {
+	return r.buf[(r.head+i)&(len(r.buf)-1)]
+}
+
+func (r *ring) len() int {
+	return r.size
+}
+
+func (r *ring) clear() {
+	switch {
+	case r.reserved == 0:
+		r.buf = nil
+	case len(r.buf) == r.reserved:
+		clear(r.buf) // prevent memory leak
+	default:
+		// release the growth beyond the reserved capacity
+		r.buf = make([]element, r.reserved)
+	}
+	r.head = 0
+	r.size = 0
+}
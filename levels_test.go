@@ -0,0 +1,195 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	var r ring
+	live := 10
+
+	for i := 0; i < live; i++ {
+		r.push(element{data: i})
+	}
+	// Continuous churn must not grow the buffer beyond the live elements
+	for i := live; i < 100000; i++ {
+		r.push(element{data: i})
+		if e := r.pop(); e.data.(int) != i-live {
+			t.Fatalf("element popped out of FIFO order, expected %d but got %d", i-live, e.data.(int))
+		}
+	}
+	if l := r.len(); l != live {
+		t.Errorf("expected %d live elements, got %d", live, l)
+	}
+	if c := len(r.buf); c > minRing {
+		t.Errorf("the buffer grew to a capacity of %d with only %d live elements", c, live)
+	}
+
+	// The buffer must shrink as the burst drains and be released once empty
+	for i := 0; i < 10000; i++ {
+		r.push(element{data: i})
+	}
+	for r.len() > live {
+		_ = r.pop()
+	}
+	if c := len(r.buf); c > 4*live {
+		t.Errorf("the buffer retained a capacity of %d with only %d live elements", c, live)
+	}
+	for r.len() > 0 {
+		_ = r.pop()
+	}
+	if r.buf != nil {
+		t.Errorf("the buffer was not released once the ring became empty")
+	}
+}
+
+func TestNewQueueLevels(t *testing.T) {
+	q := NewQueueLevels(8)
+
+	for _, p := range []QueuePriority{0, 7, 3, 5, 3, 12, -4} {
+		q.AppendPriority(int(p), p)
+	}
+	// invalid priorities are appended at the nearest level
+	for _, want := range []struct {
+		data     int
+		priority QueuePriority
+	}{
+		{7, 7}, {12, 7}, {5, 5}, {3, 3}, {3, 3}, {0, 0}, {-4, 0},
+	} {
+		if data, priority, ok := q.NextWithPriority(); !ok || data != want.data || priority != want.priority {
+			t.Errorf("expected %d at level %d, got %v at level %d", want.data, want.priority, data, priority)
+		}
+	}
+
+	q.AppendPriority("top", 7)
+	if counts := q.CountByPriority(); len(counts) != 8 || counts[7] != 1 {
+		t.Errorf("expected the counts of 8 levels with one element at the top, got %v", counts)
+	}
+
+	single := NewQueueLevels(0)
+	single.AppendPriority("first", PriorityCritical)
+	single.AppendPriority("second", PriorityLow)
+	for _, want := range []string{"first", "second"} {
+		if have, _ := single.Next(); have != want {
+			t.Errorf("a single level queue returned '%v' instead of '%s'", have, want)
+		}
+	}
+}
+
+func TestShrinkToFit(t *testing.T) {
+	q := NewQueue()
+
+	for i := 0; i < 1000; i++ {
+		q.Append(i)
+	}
+	for i := 0; i < 900; i++ {
+		_, _ = q.Next()
+	}
+
+	r := &q.(*queue).store.(*levels).levels[PriorityNormal]
+	q.ShrinkToFit()
+	if c := len(r.buf); c != 128 {
+		t.Errorf("expected the buffer to shrink to a capacity of 128 for 100 elements, got %d", c)
+	}
+	for want := 900; want < 1000; want++ {
+		if have, _ := q.Next(); have != want {
+			t.Fatalf("element popped out of order after ShrinkToFit, expected %d but got %v", want, have)
+		}
+	}
+	q.ShrinkToFit()
+	if r.buf != nil {
+		t.Errorf("the buffer was not released by ShrinkToFit once the queue became empty")
+	}
+
+	hq := NewHeapQueue()
+	for i := 0; i < 100; i++ {
+		hq.Append(i)
+	}
+	_ = hq.NextN(90)
+	hq.ShrinkToFit()
+	if h := hq.(*heapQueue).store.(*heapStore); cap(h.elements) != 10 {
+		t.Errorf("expected the heap to shrink to a capacity of 10, got %d", cap(h.elements))
+	}
+}
+
+func BenchmarkPushHeavy(b *testing.B) {
+	q := NewQueue()
+
+	b.ReportAllocs()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		q.Append(i)
+		q.Append(i)
+		_, _ = q.Next()
+	}
+	b.StopTimer()
+
+	if want, have := b.N, q.Len(); want != have {
+		b.Errorf("expected %d elements left on the queue, got %d", want, have)
+	}
+}
+
+func BenchmarkChurn(b *testing.B) {
+	q := NewQueue()
+	for i := 0; i < 1000; i++ {
+		q.Append("testing")
+	}
+
+	b.ReportAllocs()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		q.Append("testing")
+		_, _ = q.Next()
+	}
+	b.StopTimer()
+
+	l := q.(*queue).store.(*levels)
+	b.ReportMetric(float64(len(l.levels[PriorityNormal].buf)), "cap")
+	if have := q.Len(); have != 1000 {
+		b.Errorf("expected 1000 elements left on the queue, got %d", have)
+	}
+}
+
+func BenchmarkAppendBurst(b *testing.B) {
+	for _, hint := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("hint=%d", hint), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				q := NewQueue(WithInitialCapacity(hint))
+				for j := 0; j < 4*1024; j++ {
+					q.AppendPriority("testing", QueuePriority(j%numLevels))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNormalOnly(b *testing.B) {
+	queues := map[string]func() Queue{
+		// a weighted Queue always takes the general path through the cursor
+		"general": func() Queue { return NewWeightedQueue(nil) },
+		"simple":  func() Queue { return NewQueue() },
+	}
+
+	for _, name := range []string{"general", "simple"} {
+		b.Run(name, func(b *testing.B) {
+			q := queues[name]()
+			for i := 0; i < 100; i++ {
+				q.Append("testing")
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				q.Append("testing")
+				_, _ = q.Peek()
+				_, _ = q.Next()
+			}
+		})
+	}
+}
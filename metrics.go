@@ -0,0 +1,70 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "time"
+
+// Metrics receives observations about the data moving through a Queue, which allows the
+// Queue to be instrumented by a metrics system. The methods are called while the lock is
+// held, so they need to return quickly and must not use the Queue.
+type Metrics interface {
+	// ObserveEnqueue is called each time data is added to the Queue at priority.
+	ObserveEnqueue(priority QueuePriority)
+
+	// ObserveDequeue is called each time data at priority is removed by Next, or the other
+	// methods returning data such as NextN and DrainAll, along with the time it was queued.
+	ObserveDequeue(priority QueuePriority, waited time.Duration)
+
+	// SetDepth is called with the number of elements at the priority level
+	// each time the content of the Queue changes.
+	SetDepth(priority QueuePriority, n int)
+}
+
+// WithMetrics reports the activity of the Queue to m. A nil m disables the reporting.
+func WithMetrics(m Metrics) Option {
+	return func(q *queue) {
+		if m == nil {
+			q.metrics = nopMetrics{}
+			return
+		}
+
+		q.metrics = m
+		q.stamped = true
+	}
+}
+
+// nopMetrics is the Metrics used when none are provided.
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveEnqueue(QueuePriority) {}
+
+func (nopMetrics) ObserveDequeue(QueuePriority, time.Duration) {}
+
+func (nopMetrics) SetDepth(QueuePriority, int) {}
+
+// observeDepth reports the number of elements at each priority level to the Metrics.
+func (q *queue) observeDepth() {
+	if _, nop := q.metrics.(nopMetrics); nop {
+		return
+	}
+
+	if q.depths == nil {
+		q.depths = make(map[QueuePriority]bool)
+	}
+	for p := range q.depths {
+		q.depths[p] = false
+	}
+	q.store.eachLevel(func(p QueuePriority, n int) {
+		q.metrics.SetDepth(p, n)
+		q.depths[p] = true
+	})
+	// a level no longer reported, such as a HeapQueue priority without data, is now empty
+	for p, reported := range q.depths {
+		if !reported {
+			q.metrics.SetDepth(p, 0)
+			delete(q.depths, p)
+		}
+	}
+}
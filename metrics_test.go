@@ -0,0 +1,80 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	enqueued map[QueuePriority]int
+	dequeued map[QueuePriority]int
+	waited   time.Duration
+	depth    map[QueuePriority]int
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{
+		enqueued: make(map[QueuePriority]int),
+		dequeued: make(map[QueuePriority]int),
+		depth:    make(map[QueuePriority]int),
+	}
+}
+
+func (m *testMetrics) ObserveEnqueue(priority QueuePriority) { m.enqueued[priority]++ }
+
+func (m *testMetrics) ObserveDequeue(priority QueuePriority, waited time.Duration) {
+	m.dequeued[priority]++
+	m.waited = max(m.waited, waited)
+}
+
+func (m *testMetrics) SetDepth(priority QueuePriority, n int) { m.depth[priority] = n }
+
+func TestWithMetrics(t *testing.T) {
+	m := newTestMetrics()
+	q := NewQueue(WithMetrics(m))
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendAll([]any{"high1", "high2"}, PriorityHigh)
+	if m.enqueued[PriorityLow] != 1 || m.enqueued[PriorityHigh] != 2 {
+		t.Errorf("ObserveEnqueue was called %d and %d times instead of one and two",
+			m.enqueued[PriorityLow], m.enqueued[PriorityHigh])
+	}
+	if m.depth[PriorityLow] != 1 || m.depth[PriorityHigh] != 2 {
+		t.Errorf("SetDepth reported %d and %d elements instead of one and two",
+			m.depth[PriorityLow], m.depth[PriorityHigh])
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	_, _ = q.Next()
+	if m.dequeued[PriorityHigh] != 1 {
+		t.Errorf("ObserveDequeue was called %d times instead of one", m.dequeued[PriorityHigh])
+	}
+	if m.waited < 20*time.Millisecond {
+		t.Errorf("ObserveDequeue reported a wait of %v, which is shorter than the sleep", m.waited)
+	}
+	if m.depth[PriorityHigh] != 1 {
+		t.Errorf("SetDepth reported %d elements instead of one after Next", m.depth[PriorityHigh])
+	}
+
+	q.Clear()
+	if m.depth[PriorityLow] != 0 || m.depth[PriorityHigh] != 0 {
+		t.Errorf("SetDepth did not report the levels empty after Clear")
+	}
+}
+
+func TestNopMetricsAllocations(t *testing.T) {
+	q := NewQueue()
+
+	q.Append("placeholder")
+	allocs := testing.AllocsPerRun(100, func() {
+		q.Append("placeholder")
+		_, _ = q.Next()
+	})
+	if allocs > 0 {
+		t.Errorf("the default metrics caused %v allocations per append and next", allocs)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+// MultiQueue consumes several Queues as one, taking turns between them so each Queue holding
+// data is served fairly. The position is remembered across calls, so the turn continues with
+// the Queue after the one that provided the last element.
+type MultiQueue struct {
+	mu             sync.Mutex
+	queues         []Queue
+	preferPriority bool
+	turn           int
+}
+
+// NewMultiQueue returns a MultiQueue that takes turns between the queues. When preferPriority
+// is true, the data of the highest priority level held by any of the queues is returned
+// first, and the queues take turns within each level.
+func NewMultiQueue(preferPriority bool, queues ...Queue) *MultiQueue {
+	return &MultiQueue{
+		queues:         queues,
+		preferPriority: preferPriority,
+	}
+}
+
+// Next returns the data at the front of the Queue whose turn it is, or false
+// when none of the queues hold data.
+func (m *MultiQueue) Next() (any, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.preferPriority {
+		for p := PriorityCritical; p >= PriorityLow; p-- {
+			if data, ok := m.take(func(q Queue) (any, bool) { return q.NextAtLeast(p) }); ok {
+				return data, true
+			}
+		}
+	}
+	// the remaining data may be stored below the priority levels
+	return m.take(Queue.Next)
+}
+
+// take calls next for each Queue, starting with the one whose turn it is, and returns
+// the first data obtained. The turn moves to the Queue after the one providing the data.
+func (m *MultiQueue) take(next func(q Queue) (any, bool)) (any, bool) {
+	for i := range m.queues {
+		idx := (m.turn + i) % len(m.queues)
+
+		if data, ok := next(m.queues[idx]); ok {
+			m.turn = (idx + 1) % len(m.queues)
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// NextContext blocks until one of the queues holds data and returns it as Next does.
+// The context error is returned once ctx is cancelled, and ErrClosed once all the
+// queues are closed and drained.
+func (m *MultiQueue) NextContext(ctx context.Context) (any, bool, error) {
+	closed := make([]bool, len(m.queues))
+
+	for {
+		// A Queue found closed before Next fails is drained, since it accepts no more data
+		for i, q := range m.queues {
+			closed[i] = q.IsClosed()
+		}
+		if data, ok := m.Next(); ok {
+			return data, true, nil
+		}
+
+		cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}}
+		for i, q := range m.queues {
+			if !closed[i] {
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(q.Signal())})
+			}
+		}
+		if len(cases) == 1 {
+			return nil, false, ErrClosed
+		}
+
+		// An element appended after the failed Next leaves
+		// a token in the signal channel, so it cannot be missed
+		if chosen, _, _ := reflect.Select(cases); chosen == 0 {
+			return nil, false, ctx.Err()
+		}
+	}
+}
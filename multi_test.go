@@ -0,0 +1,74 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMultiQueue(t *testing.T) {
+	a, b, c := NewQueue(), NewQueue(), NewQueue()
+	m := NewMultiQueue(false, a, b, c)
+
+	if _, ok := m.Next(); ok {
+		t.Errorf("Next returned data when none of the queues hold any")
+	}
+
+	a.AppendAll([]any{"a1", "a2", "a3"}, PriorityNormal)
+	b.AppendPriority("b1", PriorityLow)
+	c.AppendPriority("c1", PriorityCritical)
+	// the queues take turns, regardless of priority
+	for _, want := range []string{"a1", "b1", "c1", "a2", "a3"} {
+		if have, ok := m.Next(); !ok || have != want {
+			t.Errorf("expected '%s' but got '%v'", want, have)
+		}
+	}
+
+	m = NewMultiQueue(true, a, b, c)
+	a.AppendPriority("a-low", PriorityLow)
+	b.AppendPriority("b-high", PriorityHigh)
+	c.AppendPriority("c-high", PriorityHigh)
+	a.AppendPriority("a-high", PriorityHigh)
+	for _, want := range []string{"a-high", "b-high", "c-high", "a-low"} {
+		if have, ok := m.Next(); !ok || have != want {
+			t.Errorf("expected '%s' but got '%v'", want, have)
+		}
+	}
+}
+
+func TestMultiQueueNextContext(t *testing.T) {
+	a, b := NewQueue(), NewQueue()
+	m := NewMultiQueue(false, a, b)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.Append("late")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if data, ok, err := m.NextContext(ctx); !ok || err != nil || data != "late" {
+		t.Errorf("NextContext returned '%v' and %v instead of the data appended later", data, err)
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelShort()
+	if _, _, err := m.NextContext(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("NextContext returned %v instead of the context error", err)
+	}
+
+	a.Append("buffered")
+	a.Close()
+	b.Close()
+	if data, ok, err := m.NextContext(ctx); !ok || err != nil || data != "buffered" {
+		t.Errorf("NextContext failed to return the data buffered in a closed queue, got '%v' and %v", data, err)
+	}
+	if _, _, err := m.NextContext(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("NextContext on closed and drained queues returned %v instead of ErrClosed", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "time"
+
+// Option configures a Queue created by NewQueue.
+type Option func(*queue)
+
+// WithAging promotes the effective priority of data by one level for each period
+// of after that the data has waited on the Queue. For example, data appended at
+// PriorityLow is treated as PriorityNormal once it has waited for after, and as
+// PriorityHigh once it has waited twice as long. When levels share an effective
+// priority, the level holding the oldest data is served first.
+func WithAging(after time.Duration) Option {
+	return func(q *queue) {
+		if l, ok := q.store.(*levels); ok && after > 0 {
+			l.aging = after
+			q.stamped = true
+		}
+	}
+}
+
+// WithInitialCapacity allocates room for perLevel elements at each priority level up front,
+// which avoids growing the storage during a burst of appends. The capacity is retained as
+// the Queue drains, while the Queue still grows beyond it as needed. The option has no
+// effect on a Queue that does not store its data in priority levels.
+func WithInitialCapacity(perLevel int) Option {
+	return func(q *queue) {
+		if l, ok := q.store.(*levels); ok {
+			for i := range l.levels {
+				l.levels[i].reserve(perLevel)
+			}
+		}
+	}
+}
+
+// WithLIFO serves the data at each priority level newest first, instead of oldest first,
+// while the levels are still served in priority order. Peek, Snapshot and the other methods
+// that follow the dequeue order reflect the end of each level served next, while the
+// overflow policies still evict the oldest data. The option has no effect on a Queue that
+// does not store its data in priority levels.
+func WithLIFO() Option {
+	return func(q *queue) {
+		if l, ok := q.store.(*levels); ok {
+			l.lifo = true
+		}
+	}
+}
+
+// WithEnqueueTime records the time each element is appended, which is returned along with
+// the data by NextTimed. Without this option, the time is only recorded when another option
+// requires it, such as WithItemTTL or WithWaitTracking.
+func WithEnqueueTime() Option {
+	return func(q *queue) {
+		q.stamped = true
+	}
+}
+
+// WithAppendInterceptor passes the data appended to the Queue, along with its priority, to fn
+// before it is stored. The data and priority returned by fn are appended instead, unless fn
+// returns false, in which case the data is discarded. Data moved between Queues by Merge,
+// including the data taken from a wrapping Queue such as a RateLimitedQueue, is not
+// intercepted. The fn function is called while the lock is held, so the
+// decision is atomic with the append, and it must not use the Queue.
+func WithAppendInterceptor(fn func(data any, priority QueuePriority) (any, QueuePriority, bool)) Option {
+	return func(q *queue) {
+		q.interceptor = fn
+	}
+}
+
+// WithRelease sets a function called with each element once the Process, ProcessContext,
+// ProcessErr, ProcessConcurrent, Flush or Consume callback handling it has returned, so the data can be
+// recycled, such as by returning it to a sync.Pool. The function is not called for data
+// obtained using Next or the other methods that remove data, which the caller is
+// responsible for releasing.
+func WithRelease(fn func(any)) Option {
+	return func(q *queue) {
+		q.release = fn
+	}
+}
+
+// releaseData passes the data to the release function once it has been processed.
+func (q *queue) releaseData(data any) {
+	if q.release != nil {
+		q.release(data)
+	}
+}
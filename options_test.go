@@ -0,0 +1,225 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithAging(t *testing.T) {
+	q := NewQueue(WithAging(100 * time.Millisecond))
+
+	q.AppendPriority("old", PriorityLow)
+	time.Sleep(250 * time.Millisecond)
+	q.AppendPriority("norm", PriorityNormal)
+	q.AppendPriority("high", PriorityHigh)
+
+	// The old element was promoted from PriorityLow to PriorityHigh
+	for _, want := range []string{"old", "high", "norm"} {
+		if e, _ := q.Peek(); e.(string) != want {
+			t.Errorf("Peek returned '%s' instead of '%s'", e.(string), want)
+		}
+		if have, _ := q.Next(); have.(string) != want {
+			t.Errorf("element popped out of aged order, expected '%s' but got '%s'", want, have)
+		}
+	}
+}
+
+func TestWithInitialCapacity(t *testing.T) {
+	q := NewQueue(WithInitialCapacity(100))
+
+	l := q.(*queue).store.(*levels)
+	if c := len(l.levels[PriorityLow].buf); c < 100 {
+		t.Errorf("the level was allocated a capacity of %d instead of at least 100", c)
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		for i := 0; i < 100; i++ {
+			q.Append("placeholder")
+		}
+		q.Clear()
+	})
+	if allocs > 1 {
+		t.Errorf("appending within the initial capacity caused %v allocations", allocs)
+	}
+	if c := len(l.levels[PriorityNormal].buf); c < 100 {
+		t.Errorf("the reserved capacity was released, only %d remains", c)
+	}
+}
+
+func TestNewQueueOptions(t *testing.T) {
+	q := NewQueue(
+		WithCapacity(3),
+		WithOverflowPolicy(EvictOldest),
+		WithDedup(func(data any) string { return data.(string) }),
+		WithWeights(map[QueuePriority]int{PriorityHigh: 2}),
+	)
+
+	for _, data := range []string{"a", "a", "b", "c", "d"} {
+		q.AppendPriority(data, PriorityHigh)
+	}
+	if l := q.Len(); l != 3 {
+		t.Errorf("expected the capacity to hold three elements, got %d", l)
+	}
+	if q.Contains("a") || !q.Contains("d") {
+		t.Errorf("the oldest element was not evicted to make room")
+	}
+
+	h := NewHeapQueue(WithCapacity(1))
+	h.Append("first")
+	if h.TryAppend("second", PriorityNormal) {
+		t.Errorf("the bounded heap queue accepted data beyond its capacity")
+	}
+}
+
+func TestWithLIFO(t *testing.T) {
+	q := NewQueue(WithLIFO())
+
+	for _, data := range []string{"n1", "n2", "n3"} {
+		q.Append(data)
+	}
+	q.AppendPriority("l1", PriorityLow)
+	q.AppendPriority("h1", PriorityHigh)
+
+	if have := q.Snapshot(); have[1] != "n3" || have[3] != "n1" {
+		t.Errorf("Snapshot returned %v instead of the LIFO order", have)
+	}
+	if have, _ := q.PeekPriority(PriorityNormal); have != "n3" {
+		t.Errorf("PeekPriority returned '%v' instead of the newest element", have)
+	}
+	for _, want := range []string{"h1", "n3", "n2", "n1", "l1"} {
+		if e, _ := q.Peek(); e != want {
+			t.Errorf("Peek returned '%v' instead of '%s'", e, want)
+		}
+		if have, _ := q.Next(); have != want {
+			t.Errorf("element popped out of LIFO order, expected '%s' but got '%v'", want, have)
+		}
+	}
+}
+
+func TestWithEnqueueTime(t *testing.T) {
+	q := NewQueue(WithEnqueueTime())
+
+	before := time.Now()
+	q.Append("timed")
+	after := time.Now()
+	data, stamp, ok := q.NextTimed()
+	if !ok || data != "timed" {
+		t.Fatalf("NextTimed returned '%v' instead of the appended data", data)
+	}
+	if stamp.Before(before) || stamp.After(after) {
+		t.Errorf("NextTimed returned the time %v outside of the call to Append", stamp)
+	}
+	if _, _, ok := q.NextTimed(); ok {
+		t.Errorf("NextTimed returned data from an empty queue")
+	}
+
+	plain := NewQueue()
+	// keep the level allocated, since the buffer of an empty level is released
+	plain.Append("untimed")
+	allocs := testing.AllocsPerRun(100, func() {
+		plain.Append("untimed")
+		if _, stamp, _ := plain.NextTimed(); !stamp.IsZero() {
+			t.Errorf("NextTimed returned a time without WithEnqueueTime")
+		}
+	})
+	if allocs > 0 {
+		t.Errorf("NextTimed without WithEnqueueTime caused %v allocations", allocs)
+	}
+
+	// the times of the data removed without being dequeued are pruned
+	for i := range 1000 {
+		q.Append(i)
+		q.Remove(i)
+	}
+	q.Append("kept")
+	if n := len(q.(*queue).stamps.values); n > 2*minRing {
+		t.Errorf("expected the times of the removed data to be pruned, got %d entries", n)
+	}
+	if _, stamp, _ := q.NextTimed(); stamp.IsZero() {
+		t.Errorf("the time of the data on the queue was pruned")
+	}
+}
+
+func TestWithAppendInterceptor(t *testing.T) {
+	q := NewQueue(WithAppendInterceptor(func(data any, priority QueuePriority) (any, QueuePriority, bool) {
+		s := data.(string)
+		if s == "invalid" {
+			return nil, priority, false
+		}
+		if s == "urgent" {
+			priority = PriorityCritical
+		}
+		return strings.ToUpper(s), priority, true
+	}))
+
+	q.Append("first")
+	q.Append("invalid")
+	q.AppendAll([]any{"second", "urgent"}, PriorityLow)
+	if err := q.AppendContext(context.Background(), "invalid", PriorityHigh); err != nil {
+		t.Errorf("AppendContext returned %v for intercepted data", err)
+	}
+
+	expected := []struct {
+		data     string
+		priority QueuePriority
+	}{
+		{"URGENT", PriorityCritical},
+		{"FIRST", PriorityNormal},
+		{"SECOND", PriorityLow},
+	}
+	for _, want := range expected {
+		if data, priority, ok := q.NextWithPriority(); !ok || data != want.data || priority != want.priority {
+			t.Errorf("expected '%s' at %s, got '%v' at %s", want.data, want.priority, data, priority)
+		}
+	}
+	if !q.Empty() {
+		t.Errorf("the interceptor failed to drop data, %d elements remain", q.Len())
+	}
+
+	// data moved by Merge is not intercepted, whether or not other wraps a Queue
+	other := NewQueue()
+	wrapped := NewRateLimitedQueue(NewQueue(), 1)
+	other.Append("invalid")
+	wrapped.Append("merged")
+	q.Merge(other)
+	q.Merge(wrapped)
+	for _, want := range []string{"invalid", "merged"} {
+		if data, _ := q.Next(); data != want {
+			t.Errorf("expected '%s' to be merged unchanged, got '%v'", want, data)
+		}
+	}
+}
+
+func TestWithRelease(t *testing.T) {
+	var events []string
+	q := NewQueue(WithRelease(func(data any) {
+		events = append(events, "release "+data.(string))
+	}))
+
+	q.AppendAll([]any{"first", "second"}, PriorityNormal)
+	q.Process(func(data any) {
+		events = append(events, "process "+data.(string))
+	})
+
+	expected := []string{"process first", "release first", "process second", "release second"}
+	if len(events) != len(expected) {
+		t.Fatalf("expected the events %v, got %v", expected, events)
+	}
+	for i, want := range expected {
+		if events[i] != want {
+			t.Errorf("expected the event '%s' but got '%s'", want, events[i])
+		}
+	}
+
+	q.Append("third")
+	_, _ = q.Next()
+	if len(events) != len(expected) {
+		t.Errorf("data obtained using Next was released")
+	}
+}
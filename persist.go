@@ -0,0 +1,133 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+)
+
+// savedJSON is the JSON form of an element written by Save.
+type savedJSON struct {
+	Priority QueuePriority   `json:"priority"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// savedGob is the gob form of an element encoded by GobEncode.
+type savedGob struct {
+	Priority QueuePriority
+	Data     any
+}
+
+// Restore returns a new Queue holding the data read from a stream written by gob
+// encoding a Queue, such as gob.NewEncoder(w).Encode(q).
+func Restore(r io.Reader) (Queue, error) {
+	q := NewQueue()
+
+	if err := gob.NewDecoder(r).Decode(q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// GobEncode implements the Queue interface.
+func (q *queue) GobEncode() ([]byte, error) {
+	q.Lock()
+	saved := make([]savedGob, 0, q.store.len())
+	q.store.walk(func(e element) bool {
+		saved = append(saved, savedGob{Priority: e.priority, Data: e.data})
+		return true
+	})
+	q.Unlock()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(saved); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements the Queue interface.
+func (q *queue) GobDecode(data []byte) error {
+	var saved []savedGob
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&saved); err != nil {
+		return err
+	}
+
+	elements := make([]any, 0, len(saved))
+	priorities := make([]QueuePriority, 0, len(saved))
+	for _, s := range saved {
+		elements = append(elements, s.Data)
+		priorities = append(priorities, s.Priority)
+	}
+	return q.restore(elements, priorities)
+}
+
+// Save implements the Queue interface.
+func (q *queue) Save(w io.Writer) error {
+	q.Lock()
+	saved := make([]savedJSON, 0, q.store.len())
+	var err error
+	q.store.walk(func(e element) bool {
+		var data []byte
+
+		data, err = json.Marshal(e.data)
+		if err != nil {
+			return false
+		}
+		saved = append(saved, savedJSON{Priority: e.priority, Data: data})
+		return true
+	})
+	q.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(saved)
+}
+
+// Load implements the Queue interface.
+func (q *queue) Load(r io.Reader, decode func(json.RawMessage) (any, error)) error {
+	var saved []savedJSON
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+
+	data := make([]any, 0, len(saved))
+	priorities := make([]QueuePriority, 0, len(saved))
+	for _, s := range saved {
+		d, err := decode(s.Data)
+		if err != nil {
+			return err
+		}
+		data = append(data, d)
+		priorities = append(priorities, s.Priority)
+	}
+	return q.restore(data, priorities)
+}
+
+// restore appends each element of data at the priority with the same index.
+func (q *queue) restore(data []any, priorities []QueuePriority) error {
+	q.Lock()
+	defer q.unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	var pushed bool
+	stamp := q.stamp()
+	for i, d := range data {
+		if q.push(d, priorities[i], stamp) {
+			pushed = true
+		}
+	}
+	if pushed {
+		q.notify()
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	type job struct {
+		Name string `json:"name"`
+	}
+	decode := func(raw json.RawMessage) (any, error) {
+		var j job
+		err := json.Unmarshal(raw, &j)
+		return &j, err
+	}
+
+	var empty bytes.Buffer
+	if err := NewQueue().Save(&empty); err != nil {
+		t.Fatalf("failed to save an empty Queue: %v", err)
+	}
+	restored := NewQueue()
+	if err := restored.Load(&empty, decode); err != nil || !restored.Empty() {
+		t.Errorf("failed to round-trip an empty Queue: %v", err)
+	}
+
+	q := NewQueue()
+	q.AppendPriority(&job{Name: "low"}, PriorityLow)
+	q.AppendPriority(&job{Name: "norm1"}, PriorityNormal)
+	q.AppendPriority(&job{Name: "crit"}, PriorityCritical)
+	q.AppendPriority(&job{Name: "norm2"}, PriorityNormal)
+	q.AppendPriority(&job{Name: "high"}, PriorityHigh)
+
+	var buf bytes.Buffer
+	if err := q.Save(&buf); err != nil {
+		t.Fatalf("failed to save the Queue: %v", err)
+	}
+	if l := q.Len(); l != 5 {
+		t.Errorf("Save changed the length of the Queue to %d", l)
+	}
+
+	restored = NewQueue()
+	if err := restored.Load(&buf, decode); err != nil {
+		t.Fatalf("failed to load the Queue: %v", err)
+	}
+	if l := restored.LenPriority(PriorityNormal); l != 2 {
+		t.Errorf("expected 2 elements restored at PriorityNormal, got %d", l)
+	}
+	for _, want := range []string{"crit", "high", "norm1", "norm2", "low"} {
+		if e, ok := restored.Next(); !ok || e.(*job).Name != want {
+			t.Errorf("element restored out of order, expected '%s'", want)
+		}
+	}
+
+	if err := restored.Load(bytes.NewBufferString("not json"), decode); err == nil {
+		t.Errorf("Load did not return an error for malformed input")
+	}
+}
+
+type checkpoint struct {
+	Name string
+}
+
+func TestGobRestore(t *testing.T) {
+	gob.Register(&checkpoint{})
+
+	var empty bytes.Buffer
+	if err := gob.NewEncoder(&empty).Encode(NewQueue()); err != nil {
+		t.Fatalf("failed to encode an empty Queue: %v", err)
+	}
+	if q, err := Restore(&empty); err != nil || !q.Empty() {
+		t.Errorf("failed to round-trip an empty Queue: %v", err)
+	}
+
+	q := NewQueue()
+	q.AppendPriority(&checkpoint{Name: "low"}, PriorityLow)
+	q.AppendPriority(&checkpoint{Name: "crit1"}, PriorityCritical)
+	q.AppendPriority(&checkpoint{Name: "norm"}, PriorityNormal)
+	q.AppendPriority(&checkpoint{Name: "crit2"}, PriorityCritical)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(q); err != nil {
+		t.Fatalf("failed to encode the Queue: %v", err)
+	}
+	restored, err := Restore(&buf)
+	if err != nil {
+		t.Fatalf("failed to restore the Queue: %v", err)
+	}
+	if l := restored.LenPriority(PriorityCritical); l != 2 {
+		t.Errorf("expected 2 elements restored at PriorityCritical, got %d", l)
+	}
+	for _, want := range []string{"crit1", "crit2", "norm", "low"} {
+		if e, ok := restored.Next(); !ok || e.(*checkpoint).Name != want {
+			t.Errorf("element restored out of order, expected '%s'", want)
+		}
+	}
+	if l := q.Len(); l != 4 {
+		t.Errorf("encoding changed the length of the Queue to %d", l)
+	}
+}
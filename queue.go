@@ -5,9 +5,26 @@
 package queue
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"math"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
 )
 
+// ErrClosed is returned by blocking methods once the Queue has been closed and drained.
+var ErrClosed = errors.New("queue: closed")
+
 type QueuePriority int
 
 // The priority levels for the priority Queue.
@@ -18,46 +35,732 @@ const (
 	PriorityCritical QueuePriority = 3
 )
 
+const numLevels = int(PriorityCritical) + 1
+
+// Valid returns true when the priority is one of the four priority levels.
+func (p QueuePriority) Valid() bool {
+	return p >= PriorityLow && p <= PriorityCritical
+}
+
+// String returns the name of the priority level, such as "Normal".
+func (p QueuePriority) String() string {
+	switch p {
+	case PriorityLow:
+		return "Low"
+	case PriorityNormal:
+		return "Normal"
+	case PriorityHigh:
+		return "High"
+	case PriorityCritical:
+		return "Critical"
+	}
+	return "QueuePriority(" + strconv.Itoa(int(p)) + ")"
+}
+
 // Queue implements a FIFO data structure that can support a few priorities.
+//
+// A Queue is in one of three states. While open, data can be appended, and Next returns
+// false when the Queue is empty, which only means no data is available yet. Once Close is
+// called, the Queue is closed: appends are discarded, the signal channel is closed, and
+// the data already on the Queue can still be removed. Once a closed Queue is empty, and
+// holds no data that is not yet visible, such as the delayed data of a DelayQueue, it is
+// closed and drained, which is final: Next keeps returning false, while NextContext and
+// the other blocking methods return ErrClosed. IsClosed tells the open and closed states
+// apart, so a consumer receiving false from Next can decide whether to wait or stop.
+//
+// Data appended at the same priority level is always removed in the order it was appended,
+// regardless of how the appends at the other levels interleave, unless WithLIFO is used.
 type Queue interface {
 	// Append adds the data to the Queue at priority level PriorityNormal.
 	Append(data any)
 
-	// AppendPriority adds the data to the Queue with respect to priority.
+	// AppendPriority adds the data to the Queue with respect to priority. A Queue storing
+	// its data in the four priority levels appends data with an invalid priority at the
+	// nearest level, so PriorityCritical is used for higher values and PriorityLow for
+	// lower values. The same applies to the other methods accepting a priority for new data.
 	AppendPriority(data any, priority QueuePriority)
 
-	// Signal returns the Queue signal channel.
+	// TryAppend adds the data to the Queue with respect to priority, and returns
+	// false without adding it when the Queue is closed or a bounded Queue is full.
+	TryAppend(data any, priority QueuePriority) bool
+
+	// Reserve holds n slots of a bounded Queue for the data appended later using
+	// AppendReserved, and returns false without holding any when fewer than n slots are
+	// available or the Queue is closed. The held slots count against the capacity until they
+	// are used, released using ReleaseReservation, or discarded by Reset. An unbounded Queue
+	// always has room.
+	Reserve(n int) bool
+
+	// AppendReserved adds the data to the Queue with respect to priority using one of the
+	// slots held by Reserve, so the data is not rejected or evicting other data due to the
+	// capacity. Without a held slot, AppendReserved is the same as AppendPriority.
+	AppendReserved(data any, priority QueuePriority)
+
+	// ReleaseReservation returns n of the slots held by Reserve to the Queue.
+	ReleaseReservation(n int)
+
+	// AppendContext adds the data to the Queue with respect to priority, blocking while a
+	// bounded Queue is full until space is available or ctx is cancelled. Blocked callers
+	// are admitted in the order they arrived. ErrClosed is returned once the Queue is closed.
+	AppendContext(ctx context.Context, data any, priority QueuePriority) error
+
+	// AppendIf adds the data to the Queue with respect to priority only when cond returns
+	// true, and returns true when the data was added. The lock is held from calling cond until
+	// the data is added, so no other caller can change the Queue in between. The Queue passed
+	// to cond is a copy holding the same data, in the same order and at the same priorities,
+	// which cond is free to use, although changes to the copy do not affect the Queue. Making
+	// the copy takes time proportional to the length of the Queue.
+	AppendIf(data any, priority QueuePriority, cond func(q Queue) bool) bool
+
+	// AppendAll adds each element of data to the Queue with respect to priority,
+	// acquiring the lock and firing the signal only once.
+	AppendAll(data []any, priority QueuePriority)
+
+	// AppendDeadline adds the data to the Queue at priority level PriorityNormal along with
+	// the deadline it should be handled by. The data is promoted to a higher level as the
+	// deadline nears when the Queue uses WithDeadlinePromotion, and otherwise the deadline
+	// is ignored.
+	AppendDeadline(data any, deadline time.Time)
+
+	// Signal returns the Queue signal channel. Each change to the Queue leaves a token in the
+	// channel if, and only if, data remains on the Queue, so a consumer waiting on the channel
+	// cannot miss data. When several consumers share the Queue, the data announced by a token
+	// may be taken by another consumer first, so a receiver must expect Next to return false.
 	Signal() <-chan struct{}
 
+	// SignalPriority returns a channel that receives a token each time data is appended at
+	// priority or a higher level, starting with a token when such data is already queued, so
+	// a consumer of the high levels is not woken by the lower ones. Tokens are coalesced and
+	// may outlive the data announced, so a receiver must expect a method such as NextAtLeast
+	// to return false. The channel is closed by Close.
+	SignalPriority(priority QueuePriority) <-chan struct{}
+
 	// Next returns the data at the front of the Queue.
 	Next() (any, bool)
 
+	// NextWithPriority returns the data at the front of the Queue along with
+	// the priority level it was stored at.
+	NextWithPriority() (any, QueuePriority, bool)
+
+	// NextWithSeq returns the data at the front of the Queue along with the sequence number
+	// assigned when it was appended. The sequence numbers increase with each element appended
+	// since the Queue was created or Reset, across all the priority levels, so they show
+	// the order the data arrived in. The data keeps its sequence number when it moves to
+	// another level, such as by UpdatePriority, MoveAll or WithDeadlinePromotion.
+	NextWithSeq() (any, uint64, bool)
+
+	// NextTimed returns the data at the front of the Queue along with the time it was
+	// appended. The time is zero unless the Queue records it, which WithEnqueueTime enables.
+	NextTimed() (any, time.Time, bool)
+
+	// TryNext returns the data at the front of the Queue, or false when the Queue is empty.
+	// TryNext never blocks and never waits on the signal channel; like Next, it only keeps
+	// the signal asserted while data remains on the Queue.
+	TryNext() (any, bool)
+
+	// NextContext blocks until data is available at the front of the Queue,
+	// or returns the context error once ctx is cancelled or its deadline passes.
+	// ErrClosed is returned when the Queue has been closed and drained.
+	NextContext(ctx context.Context) (any, bool, error)
+
+	// WaitNext blocks until data is available at the front of the Queue and returns it.
+	// False is only returned once the Queue has been closed and drained.
+	WaitNext() (any, bool)
+
+	// NextTimeout returns the data at the front of the Queue, waiting up to d for data to
+	// become available. False is returned when no data arrives within d, or once the Queue
+	// has been closed and drained.
+	NextTimeout(d time.Duration) (any, bool)
+
+	// NextPriority returns the data at the front of exactly the priority level, even when
+	// other levels hold data of higher priority. False is returned when the level is empty.
+	NextPriority(priority QueuePriority) (any, bool)
+
+	// NextAtLeast returns the first element, in the order they would be returned by Next,
+	// stored at the minimum priority level or higher, which is the data of highest priority
+	// unless the Queue is weighted or aged. Lower levels are ignored, even when they are the
+	// only levels holding data, and false is returned when no such element is queued.
+	NextAtLeast(minimum QueuePriority) (any, bool)
+
+	// NextFunc removes and returns the data at the front of the Queue only when pred returns
+	// true for it, and otherwise returns false leaving the Queue unchanged. Only the single
+	// element at the front is inspected, never the elements behind it. The pred function is
+	// called while the lock is held and must not use the Queue.
+	NextFunc(pred func(any) bool) (any, bool)
+
+	// CompareAndNext removes and returns the data at the front of the Queue only when it is
+	// equal to expected using ==, and otherwise returns false leaving the Queue unchanged.
+	// Data of a type that is not comparable never matches, so the data appended and expected
+	// should be comparable, such as pointers or IDs.
+	CompareAndNext(expected any) (any, bool)
+
+	// NextN returns up to n elements from the front of the Queue in the order
+	// they would be returned by Next. The slice is empty when no data is available.
+	NextN(n int) []any
+
+	// Channel returns a channel that receives the data on the Queue in the order it would
+	// be returned by Next. The first call starts a goroutine that feeds the channel, holding
+	// one element at a time while waiting for a receiver, and the channel is closed once the
+	// Queue has been closed and drained. Using Channel concurrently with Next, or any other
+	// method that removes data, is unsupported, since the consumers would steal elements
+	// from each other.
+	Channel() <-chan any
+
+	// Channels returns n channels that share the data of the Queue, each element being sent
+	// on exactly one of them in turn, so a fixed pool of consumers can receive the data in the
+	// order it would be returned by Next. Each call starts a goroutine that feeds the channels,
+	// holding one element at a time while waiting for the receiver whose turn it is, so a slow
+	// receiver delays the others. The channels are closed once the Queue has been closed and
+	// drained. An n less than one returns no channels. Like Channel, using Channels
+	// concurrently with another method that removes data is unsupported.
+	Channels(n int) []<-chan any
+
 	// Peek returns the data at the fron of the Queue
 	// without changing the Queue.
 	Peek() (any, bool)
 
-	// Process will execute the callback parameter for each element on the Queue.
+	// PeekPriority returns the data at the front of exactly the priority level,
+	// regardless of the data at other levels, without changing the Queue.
+	PeekPriority(priority QueuePriority) (any, bool)
+
+	// PeekN returns up to n elements from the front of the Queue in the order they would
+	// be returned by Next, without changing the Queue. The slice is empty when no data is
+	// available, and holds all the data when fewer than n elements are on the Queue.
+	PeekN(n int) []any
+
+	// PeekAt returns the data at position index, counting from zero at the front, in the order
+	// it would be returned by Next, without changing the Queue. False is returned when index
+	// is outside of the Queue.
+	PeekAt(index int) (any, bool)
+
+	// Process will execute the callback parameter for each element on the Queue, obtaining
+	// each element using Next until the Queue is empty. Data appended by a callback is on the
+	// Queue before the callback returns, so it is always handled by the same call to Process,
+	// in its priority order with the remaining data. Use Flush to handle only the data present
+	// when the call is made.
 	Process(callback func(any))
 
+	// ProcessContext will execute the callback parameter for each element on the Queue,
+	// returning early once ctx is cancelled and leaving unprocessed elements on the Queue.
+	ProcessContext(ctx context.Context, callback func(any))
+
+	// Consume will execute the callback parameter for each element on the Queue, waiting on
+	// the signal channel for more data whenever the Queue is empty, until quit is closed or
+	// the Queue is closed and drained. Once quit is closed, Consume returns after the current
+	// callback has finished, leaving the unprocessed elements on the Queue.
+	Consume(quit <-chan struct{}, callback func(any))
+
+	// ProcessErr will execute the callback parameter for each element on the Queue, stopping
+	// at the first callback that returns an error and returning that error. The element
+	// passed to the failed callback has already left the Queue and is not appended again,
+	// while the elements not yet processed remain on the Queue.
+	ProcessErr(callback func(any) error) error
+
+	// ProcessConcurrent will execute the callback parameter for each element on the Queue
+	// using the number of workers requested, or runtime.NumCPU when workers is less than one.
+	// Each worker obtains the current front of the Queue using Next, and ProcessConcurrent
+	// returns once the Queue is empty and all workers have finished.
+	ProcessConcurrent(workers int, callback func(any))
+
+	// Flush removes all the data on the Queue in a single step, as DrainAll does, and then
+	// executes the callback parameter for each element in the order it would be returned by
+	// Next. The callback is executed without the lock, and data appended while Flush is
+	// executing callbacks is left on the Queue for the next call.
+	Flush(callback func(any))
+
+	// Snapshot returns a copy of all the data on the Queue in the order it
+	// would be returned by Next, without changing the Queue.
+	Snapshot() []any
+
+	// ForEach calls fn for each element on the Queue, in the order they would be returned
+	// by Next, until fn returns false. The elements are copied under the lock before fn is
+	// called, so the view is consistent and fn is free to use the Queue. The Queue is not
+	// changed by ForEach.
+	ForEach(fn func(data any) bool)
+
+	// Iterator returns a QueueIterator over a copy of the data on the Queue, taken under the
+	// lock in the order it would be returned by Next. The Queue is not changed by iterating.
+	Iterator() QueueIterator
+
+	// Remove deletes the first element, in the order they would be returned by Next, that
+	// is equal to data using ==, and returns true when an element was removed. Data of a type
+	// that is not comparable never matches an element.
+	Remove(data any) bool
+
+	// RemoveFunc deletes every element for which pred returns true, preserving
+	// the order of the remaining elements, and returns the number removed.
+	// The pred function is called while the lock is held and must not use the Queue.
+	RemoveFunc(pred func(any) bool) int
+
+	// Contains returns true when an element on the Queue is equal to data using ==.
+	// Data of a type that is not comparable never matches an element.
+	Contains(data any) bool
+
+	// ContainsFunc returns true when pred returns true for an element on the Queue.
+	// The pred function is called while the lock is held and must not use the Queue.
+	ContainsFunc(pred func(any) bool) bool
+
+	// UpdatePriority moves the first element, in the order they would be returned by Next,
+	// that is equal to data using == to the back of the newPriority level in a single step,
+	// and returns true when the element was found and moved. The element is left in place
+	// when newPriority is not one of the priority levels supported by the Queue, or when the
+	// newPriority level is full under WithLevelCapacity.
+	UpdatePriority(data any, newPriority QueuePriority) bool
+
+	// MoveAll moves every element at the from level to the back of the to level in a single
+	// step, preserving the order they were appended in, and returns the number moved. Nothing
+	// is moved when the levels are the same, or to is not supported by the Queue. When the to
+	// level is bounded by WithLevelCapacity, only the elements appended first that fit on it
+	// are moved, and the others remain at the from level.
+	MoveAll(from, to QueuePriority) int
+
+	// Rebalance moves every element to the priority returned by fn for its data and current
+	// priority in a single step. The elements at each resulting level are kept in the order
+	// they were appended in. Invalid priorities are handled as AppendPriority does. An element
+	// that would join a level already full under WithLevelCapacity, counting the elements yet
+	// to leave it, is left at its current level. The fn function is called while the lock is
+	// held and must not use the Queue.
+	Rebalance(fn func(data any, current QueuePriority) QueuePriority)
+
+	// DrainAll removes and returns all the data on the Queue in the order it
+	// would be returned by Next. The slice is empty when no data is available.
+	DrainAll() []any
+
+	// DrainPriority removes and returns all the data at exactly the priority level, in the
+	// order it would be returned by NextPriority, leaving the other levels unchanged. The
+	// slice is empty when the level holds no data.
+	DrainPriority(priority QueuePriority) []any
+
+	// DrainFunc removes and returns the data of every element for which pred returns true,
+	// in the order it would be returned by Next, preserving the order of the remaining
+	// elements. The slice is empty when no element matches. The pred function is called
+	// while the lock is held and must not use the Queue.
+	DrainFunc(pred func(any) bool) []any
+
+	// DrainTo removes all the data on the Queue, as DrainAll does, and sends it to ch in the
+	// order it would be returned by Next, returning the number of elements sent. Data appended
+	// while DrainTo is sending is left on the Queue. DrainTo blocks until ch has received all
+	// the data, and it does not close ch.
+	DrainTo(ch chan<- any) int
+
+	// Split removes all the data from the Queue and distributes it between two new Queues,
+	// storing the data in the same priority levels as the Queue but without its options,
+	// placing the data for which pred returns true in match and the remaining data in rest.
+	// Each element keeps its priority and its order within the level.
+	// The pred function is called while the lock is held and must not use the Queue.
+	Split(pred func(any) bool) (match Queue, rest Queue)
+
+	// Merge removes all the data from other and appends each element to the Queue at its
+	// original priority, so the order of each level is preserved. Both locks are held for
+	// the whole move, acquired in a consistent order so concurrent merges cannot deadlock,
+	// while a type wrapping another Queue, such as a RateLimitedQueue, is drained one level
+	// at a time instead. Data rejected by a full bounded Queue is discarded. Nothing is
+	// removed from other once the Queue is closed.
+	Merge(other Queue)
+
+	// Clear removes all the data from the Queue.
+	Clear()
+
+	// Trim removes elements until the Queue holds no more than limit elements, starting with
+	// the oldest element at the lowest priority level holding data, and returns the removed
+	// data in the order it was removed. The slice is empty when nothing was removed.
+	Trim(limit int) []any
+
+	// ShrinkToFit releases the memory held by the Queue beyond what its current elements
+	// require, such as the capacity grown during a burst. The order of the data is preserved,
+	// and the capacity requested using WithInitialCapacity is retained.
+	ShrinkToFit()
+
+	// Reset removes all the data from the Queue and zeroes its counters and wait statistics,
+	// leaving the Queue as if it was freshly constructed with the same options and hooks.
+	// The signal channel is left without a pending token. A closed Queue remains closed.
+	Reset()
+
 	// Empty returns true if the Queue is empty.
 	Empty() bool
 
-	// Len returns the current length of the Queue.
+	// Len returns the current length of the Queue. The length is read without acquiring
+	// the lock, unless the Queue discards or promotes data while it is being read.
 	Len() int
+
+	// WaitUntilEmpty blocks until the Queue is empty and returns nil,
+	// or returns the context error once ctx is cancelled or its deadline passes.
+	WaitUntilEmpty(ctx context.Context) error
+
+	// IsFull returns true when a bounded Queue holds as many elements as its capacity, counting
+	// the slots held by Reserve, and is always false for an unbounded Queue. Like Len, it does
+	// not acquire the lock.
+	IsFull() bool
+
+	// LenPriority returns the current number of elements at the priority level.
+	LenPriority(priority QueuePriority) int
+
+	// CountByPriority returns the number of elements at each of the priority levels,
+	// including levels without data, obtained under a single acquisition of the lock.
+	// A HeapQueue reports the four named levels along with each other priority holding data.
+	CountByPriority() map[QueuePriority]int
+
+	// DepthSamples returns the most recent lengths of the Queue recorded by WithDepthSampling,
+	// oldest first. The slice is empty when the option is not used or no sample was recorded.
+	DepthSamples() []int
+
+	// Stats returns a consistent snapshot of the Queue state and counters.
+	Stats() Stats
+
+	// ApproxBytes returns an estimate of the memory held by the Queue, which is the sum of
+	// sizeof called for the data of each element, including the data not yet visible, plus
+	// the bookkeeping the Queue allocates for the elements. The bookkeeping includes the
+	// capacity allocated but unused, which ShrinkToFit releases. The sizeof function is
+	// called while the lock is held and must not use the Queue.
+	ApproxBytes(sizeof func(any) int) int
+
+	// AverageWait returns the average time spent on the Queue by the elements removed since
+	// the previous call, and then starts a new average. Zero is returned when no elements
+	// were removed, or the Queue was not created using WithWaitTracking.
+	AverageWait() time.Duration
+
+	// WaitHistogram returns the number of elements removed since the previous call that
+	// spent up to 1ms, 10ms, 100ms, 1s and 10s on the Queue, followed by the number that
+	// spent longer, and then starts counting again. The counts are zero when the Queue
+	// was not created using WithWaitTracking.
+	WaitHistogram() []uint64
+
+	// OnAppend sets a function called with each element added to the Queue, along with
+	// the priority it was stored at. The function is called after the lock is released,
+	// so it is free to use the Queue. A nil function removes the hook.
+	OnAppend(fn func(data any, priority QueuePriority))
+
+	// OnNext sets a function called with each element dequeued by Next or the other methods
+	// returning data, such as NextN and DrainAll, along with the priority it was stored at.
+	// Data discarded by Remove, Clear or Trim is not reported. The function is called after
+	// the lock is released, so it is free to use the Queue. A nil function removes the hook.
+	OnNext(fn func(data any, priority QueuePriority))
+
+	// Save writes all the data on the Queue as JSON to w, along with the priority of each
+	// element, in the order it would be returned by Next. The Queue is not changed by Save.
+	Save(w io.Writer) error
+
+	// Load reads JSON written by Save from r and appends each element at its saved priority,
+	// so the order of each level is restored. The decode function converts each saved element
+	// into its concrete type. Nothing is appended when r or decode returns an error, and
+	// ErrClosed is returned when the Queue has been closed.
+	Load(r io.Reader, decode func(json.RawMessage) (any, error)) error
+
+	// GobEncode encodes all the data on the Queue, along with the priority of each element,
+	// in the order it would be returned by Next. The concrete types of the data must be
+	// registered using gob.Register. The Queue is not changed by GobEncode.
+	GobEncode() ([]byte, error)
+
+	// GobDecode appends each element encoded by GobEncode at its encoded priority,
+	// so the order of each level is restored. Nothing is appended on error.
+	GobDecode(data []byte) error
+
+	// Watch returns a channel that receives the length of the Queue each time it grows or
+	// shrinks, starting with the current length. The values are coalesced, so a watcher that
+	// falls behind receives only the latest length. The channel is closed by Close.
+	Watch() <-chan int
+
+	// IsClosed returns true once Close has been called.
+	IsClosed() bool
+
+	// Close marks the Queue closed and closes the signal channel to wake up consumers.
+	// Data appended after Close is silently discarded, while data already on the
+	// Queue can still be obtained using Next. Calling Close more than once is safe.
+	Close()
+
+	// CloseAndDrain marks the Queue closed, as Close does, and removes and returns all the
+	// data on the Queue in the order it would be returned by Next, in a single step so no data
+	// can be appended in between. The slice is empty when no data is available.
+	CloseAndDrain() []any
 }
 
 type queue struct {
 	sync.Mutex
+	// lazy is set when reading the store can change it, so the length
+	// recorded for reading without the lock may be stale
+	lazy   bool
 	signal chan struct{}
-	low    []any
-	norm   []any
-	high   []any
-	crit   []any
+	// length is the number of elements, which can be read without the lock
+	length atomic.Int64
+	closed bool
+	store  store
+	// held is the store of a DelayQueue or an AckQueue holding the elements that are not yet
+	// visible, or nil when there is none. The store of a DelayQueue is wrapped by configure,
+	// while the store of an AckQueue wraps the others to hold the redeliveries.
+	held *delayed
+	seq  uint64
+	// appended and dequeued count the elements since the Queue was created
+	appended uint64
+	dequeued uint64
+	// capacity is the maximum length of a bounded Queue, or zero when unbounded
+	capacity int
+	overflow OverflowPolicy
+	// levelCaps is the maximum length of each priority level that is bounded
+	levelCaps map[QueuePriority]int
+	// reserved is the number of slots held by Reserve, which can be read without the lock
+	reserved atomic.Int64
+	// emptied is closed once the Queue becomes empty, when callers are waiting for it
+	emptied chan struct{}
+	outOnce sync.Once
+	out     chan any
+	// producers are blocked in AppendContext, in the order they arrived
+	producers []*producer
+	// stamped is set when the enqueue time of the elements is needed, and stamps holds it
+	stamped  bool
+	stamps   *sideTable[time.Time]
+	ttl      time.Duration
+	onExpire func(any)
+	// expiry is the store discarding the expired elements
+	expiry   *expiring
+	dedupKey func(any) string
+	// debounce is the minimum time between wakeups, and woke is when the last wakeup
+	// happened. The debouncer timer asserts the signal once a deferred wakeup is due.
+	debounce  time.Duration
+	woke      time.Time
+	debouncer *time.Timer
+	deferred  bool
+	// interceptor can rewrite or drop the data before it is appended
+	interceptor func(any, QueuePriority) (any, QueuePriority, bool)
+	// release is called with the data once a Process callback has returned
+	release func(any)
+	metrics Metrics
+	// depths records the levels last reported to the metrics, set while reporting
+	depths map[QueuePriority]bool
+	waits  *waitStats
+	// depth holds the recent lengths recorded by WithDepthSampling
+	depth *depthSamples
+	// promoteHigh and promoteCritical are the times before a deadline that the data is
+	// promoted, deadlines is the store tracking the promotions, and the promoter timer
+	// promotes the data once the earliest promotion is due
+	promoteHigh     time.Duration
+	promoteCritical time.Duration
+	deadlines       *deadlined
+	promoter        *time.Timer
+	// watchers receive the length each time it changes from watchedLen
+	watchers   []chan int
+	watchedLen int
+	// prioritySignals receive a token when data is appended at the priority or higher
+	prioritySignals map[QueuePriority]chan struct{}
+	// maxDeliveries is the number of deliveries made by an AckQueue
+	// before the data becomes a dead letter, or zero when unlimited
+	maxDeliveries int
+	// retryBase and retryFactor set the backoff of the redeliveries made by an AckQueue
+	retryBase   time.Duration
+	retryFactor float64
+	// onAppend and onNext are the lifecycle hooks, and events holds
+	// the calls recorded for them until the lock is released
+	onAppend func(any, QueuePriority)
+	onNext   func(any, QueuePriority)
+	events   []event
+}
+
+// event is a lifecycle hook call recorded while the lock is held.
+type event struct {
+	hook     func(any, QueuePriority)
+	data     any
+	priority QueuePriority
+}
+
+// element is the data stored on the Queue along with its bookkeeping. The bookkeeping
+// needed by only some of the options, such as the enqueue time, is kept in a sideTable.
+type element struct {
+	data     any
+	priority QueuePriority
+	// seq orders the elements within the store, and changes when an element joins the back
+	// of a level again, while id is the sequence number assigned when it was appended
+	seq uint64
+	id  uint64
+}
+
+// sideTable holds a value for some of the elements, keyed by their id. The entry of an
+// element is taken once it is dequeued, while the entries of the elements that left the
+// Queue otherwise are pruned once they outnumber twice the elements on it, which keeps the
+// cost of each entry constant when amortized. A nil sideTable holds no values.
+type sideTable[T any] struct {
+	values map[uint64]T
+	// limit is the number of entries that triggers the next prune
+	limit int
+}
+
+func newSideTable[T any]() *sideTable[T] {
+	return &sideTable[T]{values: make(map[uint64]T), limit: minRing}
+}
+
+func (t *sideTable[T]) get(id uint64) T {
+	var v T
+	if t != nil {
+		v = t.values[id]
+	}
+	return v
+}
+
+// take removes and returns the value of the element.
+func (t *sideTable[T]) take(id uint64) T {
+	var v T
+	if t != nil {
+		v = t.values[id]
+		delete(t.values, id)
+	}
+	return v
+}
+
+// set stores the value of the element, pruning the entries of the elements that are no
+// longer on the Queue first when the limit is reached.
+func (t *sideTable[T]) set(q *queue, id uint64, v T) {
+	if len(t.values) >= t.limit {
+		values := make(map[uint64]T)
+		n := 0
+		q.walkAll(func(e element) {
+			if v, found := t.values[e.id]; found {
+				values[e.id] = v
+			}
+			n++
+		})
+
+		t.values = values
+		t.limit = max(minRing, 2*max(n, len(values)))
+	}
+	t.values[id] = v
+}
+
+func (t *sideTable[T]) clear() {
+	if t != nil {
+		t.values = make(map[uint64]T)
+		t.limit = minRing
+	}
+}
+
+// footprint returns the approximate memory used by the entries.
+func (t *sideTable[T]) footprint() int {
+	if t == nil {
+		return 0
+	}
+	var v T
+	return len(t.values) * int(unsafe.Sizeof(uint64(0))+unsafe.Sizeof(v))
+}
+
+// store holds the elements of a Queue and determines the order they are served in.
+type store interface {
+	// push adds the element, returning false when it cannot be stored.
+	push(e element) bool
+	// fit returns the priority the store keeps an element with the priority at.
+	fit(priority QueuePriority) QueuePriority
+	// pop removes and returns the element that will be served next.
+	pop() (element, bool)
+	// peek returns the element that will be served next.
+	peek() (element, bool)
+	// popPriority removes and returns the element served next at exactly the priority level.
+	popPriority(priority QueuePriority) (element, bool)
+	// peekPriority returns the element served next at exactly the priority level.
+	peekPriority(priority QueuePriority) (element, bool)
+	len() int
+	lenPriority(priority QueuePriority) int
+	// evict removes the element chosen by the overflow policy to make room for an
+	// element at priority, returning false when the new element should be rejected.
+	evict(policy OverflowPolicy, priority QueuePriority) (element, bool)
+	// remove deletes up to limit elements matching the predicate, or all of them when
+	// limit is less than one, and returns them in the order they would have been served.
+	remove(match func(e element) bool, limit int) []element
+	// walk calls fn for each element in the order they will be served, until fn returns false.
+	walk(fn func(e element) bool)
+	clear()
+	// compact releases the capacity beyond what the elements require, preserving their order.
+	compact()
+	// eachLevel calls fn with each priority level reported for the store, along with the
+	// number of elements at the level.
+	eachLevel(fn func(priority QueuePriority, n int))
+	// footprint returns the bytes the store allocates for the bookkeeping of its elements,
+	// including the capacity that holds no element, but not the memory of their data.
+	footprint() int
+	// empty returns a new store of the same kind, holding the same priority levels, without
+	// any elements or the options of the store.
+	empty() store
+}
+
+// NewQueue returns an initialized Queue configured by the provided options, such as
+// WithCapacity, WithOverflowPolicy, WithWeights, WithAging, WithItemTTL, WithDedup and
+// WithMetrics. Without options, the Queue is unbounded and serves the priority levels
+// in strict priority order.
+func NewQueue(opts ...Option) Queue {
+	q := newQueue(newLevels(numLevels))
+
+	q.configure(opts)
+	return q
+}
+
+// configure applies the options and wraps the store with the decorators they require.
+func (q *queue) configure(opts []Option) {
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	if q.stamped {
+		q.stamps = newSideTable[time.Time]()
+		if l, ok := q.store.(*levels); ok {
+			l.stamps = q.stamps
+		}
+	}
+	if q.held != nil {
+		// delayed elements are promoted while reading
+		q.lazy = true
+		q.held.store = q.store
+		q.store = q.held
+	}
+
+	if q.promoteHigh > 0 || q.promoteCritical > 0 {
+		// elements are promoted while reading
+		q.lazy = true
+		q.deadlines = &deadlined{
+			store:    q.store,
+			high:     q.promoteHigh,
+			critical: q.promoteCritical,
+			seq:      &q.seq,
+			tracked:  make(map[uint64]*promotion),
+			stale:    make(map[uint64]QueuePriority),
+			staleAt:  make(map[QueuePriority]int),
+			caps:     q.levelCaps,
+			promoted: func(e element) { q.assertPriority(e.priority) },
+		}
+		q.store = q.deadlines
+		q.promoter = time.AfterFunc(time.Hour, q.promoteDue)
+		q.promoter.Stop()
+	}
+	if q.dedupKey != nil {
+		d := &dedup{
+			store: q.store,
+			key:   q.dedupKey,
+			keys:  make(map[string]element),
+			held:  q.held,
+		}
+		q.store = d
+		if q.deadlines != nil {
+			// the promoted copy replaces the element known by its key
+			q.deadlines.promoted = func(e element) {
+				d.keys[d.key(e.data)] = e
+				q.assertPriority(e.priority)
+			}
+		}
+	}
+	if q.ttl > 0 {
+		// expired elements are discarded while reading, through dedup to release their keys
+		q.lazy = true
+		q.expiry = &expiring{
+			store:    q.store,
+			ttl:      q.ttl,
+			onExpire: q.onExpire,
+			stamps:   q.stamps,
+		}
+		q.store = q.expiry
+	}
+	q.startSampling()
 }
 
-// NewQueue returns an initialized Queue.
-func NewQueue() Queue {
-	return &queue{signal: make(chan struct{}, 1)}
+func newQueue(s store) *queue {
+	return &queue{
+		signal:  make(chan struct{}, 1),
+		store:   s,
+		metrics: nopMetrics{},
+	}
 }
 
 // Append implements the Queue interface.
@@ -70,19 +773,258 @@ func (q *queue) AppendPriority(data any, priority QueuePriority) {
 	q.append(data, priority)
 }
 
-func (q *queue) append(data any, priority QueuePriority) {
+// TryAppend implements the Queue interface.
+func (q *queue) TryAppend(data any, priority QueuePriority) bool {
+	return q.append(data, priority)
+}
+
+func (q *queue) append(data any, priority QueuePriority) bool {
+	q.Lock()
+	defer q.unlock()
+
+	if q.closed || !q.push(data, priority, q.stamp()) {
+		return false
+	}
+
+	q.notify()
+	return true
+}
+
+// AppendIf implements the Queue interface.
+func (q *queue) AppendIf(data any, priority QueuePriority, cond func(q Queue) bool) bool {
+	q.Lock()
+	defer q.unlock()
+
+	if q.closed || !cond(q.view()) || !q.push(data, priority, q.stamp()) {
+		return false
+	}
+
+	q.notify()
+	return true
+}
+
+// view returns a copy of the Queue holding the same data, in the same order
+// and at the same priorities.
+func (q *queue) view() Queue {
+	h := newHeapStore(func(a, b element) bool { return a.seq < b.seq })
+
+	// elements in ascending sequence order already satisfy the heap invariant
+	q.store.walk(func(e element) bool {
+		e.seq = uint64(len(h.elements))
+		h.elements = append(h.elements, e)
+		h.count(e.priority, 1)
+		return true
+	})
+
+	v := newQueue(h)
+	// the elements keep their ids, so the data appended to the copy is numbered after them
+	v.seq = max(q.seq, uint64(len(h.elements)))
+	if q.stamps != nil {
+		v.stamped = true
+		v.stamps = &sideTable[time.Time]{values: maps.Clone(q.stamps.values), limit: q.stamps.limit}
+	}
+	v.syncSignal()
+	return v
+}
+
+// AppendAll implements the Queue interface.
+func (q *queue) AppendAll(data []any, priority QueuePriority) {
+	q.Lock()
+	defer q.unlock()
+
+	if q.closed || len(data) == 0 {
+		return
+	}
+
+	var pushed bool
+	stamp := q.stamp()
+	for _, d := range data {
+		if q.push(d, priority, stamp) {
+			pushed = true
+		}
+	}
+	if pushed {
+		q.notify()
+	}
+}
+
+func (q *queue) push(data any, priority QueuePriority, stamp time.Time) bool {
+	data, priority, keep := q.intercept(data, priority)
+	if !keep {
+		return false
+	}
+
+	return q.pushElement(element{data: data, priority: priority}, stamp)
+}
+
+// intercept passes new data through the append interceptor, returning false when it is dropped.
+func (q *queue) intercept(data any, priority QueuePriority) (any, QueuePriority, bool) {
+	if q.interceptor == nil {
+		return data, priority, true
+	}
+	return q.interceptor(data, priority)
+}
+
+// pushElement assigns the sequence number of the element and adds it to the store, recording
+// the enqueue time provided when the Queue records it.
+func (q *queue) pushElement(e element, stamp time.Time) bool {
+	e.priority = q.store.fit(e.priority)
+	if q.overflow == Reject && (q.full() || q.levelFull(e.priority)) {
+		return false
+	}
+
+	q.seq++
+	e.seq = q.seq
+	e.id = q.seq
+	if q.stamps != nil {
+		// the time is recorded first, since the store may read it while adding the element
+		q.stamps.set(q, e.id, stamp)
+	}
+	if !q.store.push(e) {
+		_ = q.stamps.take(e.id)
+		return false
+	}
+	if c := q.levelCaps[e.priority]; c > 0 && q.store.lenPriority(e.priority) > c {
+		q.evictLevel(e.priority)
+	}
+	// Evicting once the element is stored ensures nothing is evicted for an element the
+	// store rejects, and the policy may choose the new element itself as the one to evict
+	if q.capacity > 0 && q.store.len()+q.heldLen()+int(q.reserved.Load()) > q.capacity {
+		evicted, ok := q.store.evict(q.overflow, e.priority)
+		if ok {
+			_ = q.stamps.take(evicted.id)
+		}
+		if !ok || evicted.seq == e.seq {
+			if !ok {
+				_ = q.store.remove(func(s element) bool { return s.seq == e.seq }, 1)
+				_ = q.stamps.take(e.id)
+			}
+			return false
+		}
+	}
+
+	q.appended++
+	q.assertPriority(e.priority)
+	q.metrics.ObserveEnqueue(e.priority)
+	q.record(q.onAppend, e)
+	return true
+}
+
+// dequeue counts the element removed from the store and records it for the OnNext hook.
+func (q *queue) dequeue(e element) {
+	q.dequeued++
+	if stamp := q.stamps.take(e.id); !stamp.IsZero() {
+		waited := time.Since(stamp)
+
+		q.metrics.ObserveDequeue(e.priority, waited)
+		if q.waits != nil {
+			q.waits.observe(waited)
+		}
+	}
+	q.record(q.onNext, e)
+}
+
+func (q *queue) record(hook func(any, QueuePriority), e element) {
+	if hook != nil {
+		q.events = append(q.events, event{hook: hook, data: e.data, priority: e.priority})
+	}
+}
+
+// unlock releases the lock and then calls the hooks for the events recorded while it was
+// held. Methods that can add or remove elements must release the lock using unlock.
+func (q *queue) unlock() {
+	events := q.events
+	q.events = nil
+	q.Unlock()
+
+	for _, ev := range events {
+		ev.hook(ev.data, ev.priority)
+	}
+}
+
+// unlockBoth releases the locks of both queues, as unlock does, so the hooks recorded by
+// either are only called once neither lock is held.
+func unlockBoth(a, b *queue) {
+	events := append(a.events, b.events...)
+	a.events, b.events = nil, nil
+	b.Unlock()
+	a.Unlock()
+
+	for _, ev := range events {
+		ev.hook(ev.data, ev.priority)
+	}
+}
+
+// resync updates the signal once reading the store discarded expired elements. The
+// methods calling it must release the lock using unlock, since waiting producers may be
+// admitted.
+func (q *queue) resync() {
+	if q.expiry != nil && q.expiry.trimmed {
+		q.syncSignal()
+	}
+}
+
+// OnAppend implements the Queue interface.
+func (q *queue) OnAppend(fn func(data any, priority QueuePriority)) {
 	q.Lock()
 	defer q.Unlock()
 
-	switch priority {
-	case PriorityLow:
-		q.low = append(q.low, data)
-	case PriorityNormal:
-		q.norm = append(q.norm, data)
-	case PriorityHigh:
-		q.high = append(q.high, data)
-	case PriorityCritical:
-		q.crit = append(q.crit, data)
+	q.onAppend = fn
+}
+
+// OnNext implements the Queue interface.
+func (q *queue) OnNext(fn func(data any, priority QueuePriority)) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.onNext = fn
+}
+
+// full returns true when a bounded Queue has reached its capacity.
+func (q *queue) full() bool {
+	return q.capacity > 0 && q.store.len()+q.heldLen()+int(q.reserved.Load()) >= q.capacity
+}
+
+// walkAll calls fn with each element on the Queue, including the elements held until they
+// become visible.
+func (q *queue) walkAll(fn func(e element)) {
+	q.store.walk(func(e element) bool {
+		fn(e)
+		return true
+	})
+	if q.held != nil {
+		for _, w := range q.held.pending {
+			fn(w.e)
+		}
+	}
+}
+
+// heldLen returns the number of elements held until they become visible, which count
+// against the capacity.
+func (q *queue) heldLen() int {
+	if q.held == nil {
+		return 0
+	}
+	return len(q.held.pending)
+}
+
+// stamp returns the enqueue time for new elements, which is only tracked when required.
+func (q *queue) stamp() time.Time {
+	if q.stamped {
+		return time.Now()
+	}
+	return time.Time{}
+}
+
+func (q *queue) notify() {
+	q.changed()
+	q.assert()
+}
+
+// assert leaves a token in the signal channel, unless the token is debounced.
+func (q *queue) assert() {
+	if q.debounce > 0 && q.debounced() {
+		return
 	}
 
 	select {
@@ -91,6 +1033,14 @@ func (q *queue) append(data any, priority QueuePriority) {
 	}
 }
 
+// changed records the length of the Queue after its content changed
+// and reports it to the metrics and watchers.
+func (q *queue) changed() {
+	q.length.Store(int64(q.store.len()))
+	q.observeDepth()
+	q.publishLen()
+}
+
 // Signal implements the Queue interface.
 func (q *queue) Signal() <-chan struct{} {
 	q.Lock()
@@ -101,25 +1051,23 @@ func (q *queue) Signal() <-chan struct{} {
 }
 
 func (q *queue) prepSignal() {
-	var send bool
-
-	select {
-	case _, send = <-q.signal:
-	default:
+	if q.closed {
+		return
 	}
 
-	if !send && q.lenWithoutLock() > 0 {
-		send = true
-	}
-	if send {
-		select {
-		case q.signal <- struct{}{}:
-		default:
-		}
+	// Tokens are only sent while the lock is held, so a token found in the channel already
+	// announces the data. A receiver taking it concurrently leaves the same state as taking
+	// it after this call.
+	if len(q.signal) == 0 && q.store.len() > 0 {
+		q.assert()
 	}
 }
 
 func (q *queue) drain() {
+	if q.closed {
+		return
+	}
+
 	for {
 		select {
 		case <-q.signal:
@@ -129,65 +1077,822 @@ func (q *queue) drain() {
 	}
 }
 
+// syncSignal admits any blocked producers that now fit on the Queue, reports the new length,
+// and then asserts the signal channel if, and only if, data remains on the Queue.
+func (q *queue) syncSignal() {
+	if q.expiry != nil {
+		q.expiry.trimmed = false
+	}
+
+	q.admit()
+	q.changed()
+
+	if q.store.len() == 0 {
+		q.drain()
+		if q.emptied != nil {
+			close(q.emptied)
+			q.emptied = nil
+		}
+	} else {
+		q.prepSignal()
+	}
+}
+
 // Next implements the Queue interface.
 func (q *queue) Next() (any, bool) {
+	data, _, ok := q.NextWithPriority()
+	return data, ok
+}
+
+// NextWithPriority implements the Queue interface.
+func (q *queue) NextWithPriority() (any, QueuePriority, bool) {
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
-	var data any
-	if len(q.crit) > 0 {
-		data = q.crit[0]
-		q.crit[0] = nil // prevent memory leak
-		q.crit = q.crit[1:]
-	} else if len(q.high) > 0 {
-		data = q.high[0]
-		q.high[0] = nil
-		q.high = q.high[1:]
-	} else if len(q.norm) > 0 {
-		data = q.norm[0]
-		q.norm[0] = nil
-		q.norm = q.norm[1:]
-	} else if len(q.low) > 0 {
-		data = q.low[0]
-		q.low[0] = nil
-		q.low = q.low[1:]
-	} else {
-		q.drain()
-		return nil, false
-	}
+	e, ok := q.next()
+	return e.data, e.priority, ok
+}
 
-	q.prepSignal()
-	return data, true
+// NextWithSeq implements the Queue interface.
+func (q *queue) NextWithSeq() (any, uint64, bool) {
+	q.Lock()
+	defer q.unlock()
+
+	e, ok := q.next()
+	return e.data, e.id, ok
 }
 
-func (q *queue) Peek() (any, bool) {
+// NextTimed implements the Queue interface.
+func (q *queue) NextTimed() (any, time.Time, bool) {
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
-	var data any
-	if len(q.crit) > 0 {
-		data = q.crit[0]
-	} else if len(q.high) > 0 {
-		data = q.high[0]
-	} else if len(q.norm) > 0 {
-		data = q.norm[0]
-	} else if len(q.low) > 0 {
-		data = q.low[0]
-	} else {
-		return nil, false
+	// the enqueue time is taken when the element is dequeued
+	e, ok := q.store.pop()
+	var stamp time.Time
+	if ok {
+		stamp = q.stamps.get(e.id)
+		q.dequeue(e)
 	}
 
-	return data, true
+	q.syncSignal()
+	return e.data, stamp, ok
 }
 
-// Process implements the Queue interface.
+func (q *queue) next() (element, bool) {
+	e, ok := q.store.pop()
+	if ok {
+		q.dequeue(e)
+	}
+
+	q.syncSignal()
+	return e, ok
+}
+
+// TryNext implements the Queue interface.
+func (q *queue) TryNext() (any, bool) {
+	return q.Next()
+}
+
+// NextPriority implements the Queue interface.
+func (q *queue) NextPriority(priority QueuePriority) (any, bool) {
+	q.Lock()
+	defer q.unlock()
+
+	e, ok := q.store.popPriority(priority)
+	if ok {
+		q.dequeue(e)
+	}
+
+	q.syncSignal()
+	return e.data, ok
+}
+
+// NextAtLeast implements the Queue interface.
+func (q *queue) NextAtLeast(minimum QueuePriority) (any, bool) {
+	q.Lock()
+	defer q.unlock()
+
+	var found bool
+	var target element
+	q.store.walk(func(e element) bool {
+		found = e.priority >= minimum
+		target = e
+		return !found
+	})
+	if !found {
+		return nil, false
+	}
+
+	// the first element found at a level is the one served next at that level
+	e, ok := q.store.popPriority(target.priority)
+	if ok {
+		q.dequeue(e)
+	}
+
+	q.syncSignal()
+	return e.data, ok
+}
+
+// NextFunc implements the Queue interface.
+func (q *queue) NextFunc(pred func(any) bool) (any, bool) {
+	q.Lock()
+	defer q.unlock()
+
+	if front, ok := q.store.peek(); !ok || !pred(front.data) {
+		q.resync()
+		return nil, false
+	}
+
+	e, ok := q.next()
+	return e.data, ok
+}
+
+// CompareAndNext implements the Queue interface.
+func (q *queue) CompareAndNext(expected any) (any, bool) {
+	if !isComparable(expected) {
+		return nil, false
+	}
+
+	return q.NextFunc(func(data any) bool {
+		return isComparable(data) && data == expected
+	})
+}
+
+// NextN implements the Queue interface.
+func (q *queue) NextN(n int) []any {
+	q.Lock()
+	defer q.unlock()
+
+	results := make([]any, 0, max(0, min(n, q.store.len())))
+	for len(results) < n {
+		e, ok := q.store.pop()
+		if !ok {
+			break
+		}
+		q.dequeue(e)
+		results = append(results, e.data)
+	}
+
+	q.syncSignal()
+	return results
+}
+
+// NextContext implements the Queue interface.
+func (q *queue) NextContext(ctx context.Context) (any, bool, error) {
+	for {
+		q.Lock()
+		e, ok := q.next()
+		closed, held := q.closedWait()
+		q.unlock()
+
+		if ok {
+			return e.data, true, nil
+		} else if closed && held == nil {
+			return nil, false, ErrClosed
+		}
+
+		// An element appended after the failed Next leaves
+		// a token in the signal channel, so it cannot be missed
+		signal := q.Signal()
+		if closed {
+			signal = nil
+		}
+		select {
+		case <-signal:
+		case <-held:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// closedWait reports whether the Queue is closed, and when it is, returns a channel receiving
+// once the earliest element held until it becomes visible does, since the signal channel of a
+// closed Queue no longer blocks. A closed Queue holding no such element is drained once empty.
+func (q *queue) closedWait() (bool, <-chan time.Time) {
+	if !q.closed {
+		return false, nil
+	}
+	return true, q.held.visible()
+}
+
+// WaitNext implements the Queue interface.
+func (q *queue) WaitNext() (any, bool) {
+	data, ok, _ := q.NextContext(context.Background())
+	return data, ok
+}
+
+// NextTimeout implements the Queue interface.
+func (q *queue) NextTimeout(d time.Duration) (any, bool) {
+	// no timer is needed when data is already available
+	if data, ok := q.Next(); ok || d <= 0 {
+		return data, ok
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	data, ok, _ := q.NextContext(ctx)
+	return data, ok
+}
+
+// Peek implements the Queue interface.
+func (q *queue) Peek() (any, bool) {
+	q.Lock()
+	defer q.unlock()
+
+	e, ok := q.store.peek()
+	q.resync()
+	return e.data, ok
+}
+
+// PeekPriority implements the Queue interface.
+func (q *queue) PeekPriority(priority QueuePriority) (any, bool) {
+	q.Lock()
+	defer q.unlock()
+
+	e, ok := q.store.peekPriority(priority)
+	q.resync()
+	return e.data, ok
+}
+
+// PeekN implements the Queue interface.
+func (q *queue) PeekN(n int) []any {
+	q.Lock()
+	defer q.Unlock()
+
+	results := make([]any, 0, max(0, min(n, q.store.len())))
+	if n < 1 {
+		return results
+	}
+
+	q.store.walk(func(e element) bool {
+		results = append(results, e.data)
+		return len(results) < n
+	})
+	return results
+}
+
+// PeekAt implements the Queue interface.
+func (q *queue) PeekAt(index int) (any, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	if index < 0 || index >= q.store.len() {
+		return nil, false
+	}
+
+	var pos int
+	var data any
+	q.store.walk(func(e element) bool {
+		data = e.data
+		pos++
+		return pos <= index
+	})
+	return data, true
+}
+
+// Process implements the Queue interface.
 func (q *queue) Process(callback func(any)) {
+	q.ProcessContext(context.Background(), callback)
+}
+
+// ProcessContext implements the Queue interface.
+func (q *queue) ProcessContext(ctx context.Context, callback func(any)) {
+	for ctx.Err() == nil {
+		element, ok := q.Next()
+		if !ok {
+			return
+		}
+		callback(element)
+		q.releaseData(element)
+	}
+}
+
+// Consume implements the Queue interface.
+func (q *queue) Consume(quit <-chan struct{}, callback func(any)) {
+	for {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+
+		if element, ok := q.Next(); ok {
+			callback(element)
+			q.releaseData(element)
+			continue
+		}
+
+		q.Lock()
+		closed, held := q.closedWait()
+		drained := closed && held == nil && q.store.len() == 0
+		q.Unlock()
+		if drained {
+			return
+		}
+
+		// An element appended after the failed Next leaves
+		// a token in the signal channel, so it cannot be missed
+		signal := q.Signal()
+		if closed {
+			signal = nil
+		}
+		select {
+		case <-signal:
+		case <-held:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Snapshot implements the Queue interface.
+func (q *queue) Snapshot() []any {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.snapshot()
+}
+
+func (q *queue) snapshot() []any {
+	results := make([]any, 0, q.store.len())
+
+	q.store.walk(func(e element) bool {
+		results = append(results, e.data)
+		return true
+	})
+	return results
+}
+
+// ForEach implements the Queue interface.
+func (q *queue) ForEach(fn func(data any) bool) {
+	for _, data := range q.Snapshot() {
+		if !fn(data) {
+			return
+		}
+	}
+}
+
+// Remove implements the Queue interface.
+func (q *queue) Remove(data any) bool {
+	q.Lock()
+	defer q.unlock()
+
+	if !isComparable(data) {
+		return false
+	}
+
+	removed := q.store.remove(func(e element) bool {
+		return isComparable(e.data) && e.data == data
+	}, 1)
+
+	q.syncSignal()
+	return len(removed) > 0
+}
+
+// RemoveFunc implements the Queue interface.
+func (q *queue) RemoveFunc(pred func(any) bool) int {
+	q.Lock()
+	defer q.unlock()
+
+	removed := q.store.remove(func(e element) bool {
+		return pred(e.data)
+	}, 0)
+
+	q.syncSignal()
+	return len(removed)
+}
+
+// UpdatePriority implements the Queue interface.
+func (q *queue) UpdatePriority(data any, newPriority QueuePriority) bool {
+	q.Lock()
+	defer q.unlock()
+
+	if !isComparable(data) {
+		return false
+	}
+
+	var found bool
+	var target element
+	q.store.walk(func(e element) bool {
+		found = isComparable(e.data) && e.data == data
+		target = e
+		return !found
+	})
+	if !found || (newPriority != target.priority && q.levelFull(newPriority)) {
+		return false
+	}
+
+	// The original is removed before the moved element is stored, so its key does not
+	// reject the move under WithDedup, and it is restored when the store rejects the move
+	_ = q.store.remove(func(e element) bool { return e.seq == target.seq }, 1)
+
+	moved := target
+	q.seq++
+	moved.seq = q.seq
+	moved.priority = newPriority
+	if !q.store.push(moved) {
+		_ = q.store.push(target)
+		return false
+	}
+
+	if moved.priority > target.priority {
+		q.assertPriority(moved.priority)
+	}
+	q.syncSignal()
+	return true
+}
+
+// MoveAll implements the Queue interface.
+func (q *queue) MoveAll(from, to QueuePriority) int {
+	q.Lock()
+	defer q.unlock()
+
+	if from == to || q.store.fit(to) != to {
+		return 0
+	}
+
+	// only the elements that fit on a bounded level are moved
+	limit := 0
+	if c := q.levelCaps[to]; c > 0 {
+		if limit = c - q.store.lenPriority(to); limit <= 0 {
+			return 0
+		}
+	}
+
+	moved := q.store.remove(func(e element) bool { return e.priority == from }, limit)
+	slices.SortFunc(moved, func(a, b element) int { return cmp.Compare(a.seq, b.seq) })
+	for _, e := range moved {
+		q.seq++
+		e.seq = q.seq
+		e.priority = to
+		_ = q.store.push(e)
+	}
+	if len(moved) > 0 && to > from {
+		q.assertPriority(to)
+	}
+
+	q.syncSignal()
+	return len(moved)
+}
+
+// Rebalance implements the Queue interface.
+func (q *queue) Rebalance(fn func(data any, current QueuePriority) QueuePriority) {
+	q.Lock()
+	defer q.unlock()
+
+	if q.deadlines != nil {
+		// the data left at its level keeps its promotion
+		q.deadlines.held = make(map[uint64]*promotion)
+		defer func() { q.deadlines.held = nil }()
+	}
+
+	moved := q.store.remove(func(element) bool { return true }, 0)
+	slices.SortFunc(moved, func(a, b element) int { return cmp.Compare(a.seq, b.seq) })
+
+	// held counts the elements at each level, including those yet to leave it, so
+	// the data only joins a bounded level when it has room
+	var held map[QueuePriority]int
+	if q.levelCaps != nil {
+		held = make(map[QueuePriority]int)
+		for _, e := range moved {
+			held[e.priority]++
+		}
+	}
+
+	for _, e := range moved {
+		current := e.priority
+		e.priority = q.store.fit(fn(e.data, current))
+		if held != nil && e.priority != current {
+			if c := q.levelCaps[e.priority]; c > 0 && held[e.priority] >= c {
+				e.priority = current
+			} else {
+				held[e.priority]++
+				held[current]--
+			}
+		}
+		_ = q.store.push(e)
+
+		if e.priority > current {
+			q.assertPriority(e.priority)
+		}
+	}
+
+	q.syncSignal()
+}
+
+// Contains implements the Queue interface.
+func (q *queue) Contains(data any) bool {
+	if !isComparable(data) {
+		return false
+	}
+
+	return q.ContainsFunc(func(d any) bool {
+		return isComparable(d) && d == data
+	})
+}
+
+// ContainsFunc implements the Queue interface.
+func (q *queue) ContainsFunc(pred func(any) bool) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	var found bool
+	q.store.walk(func(e element) bool {
+		found = pred(e.data)
+		return !found
+	})
+	return found
+}
+
+// isComparable returns true when the data can be compared using == without panicking.
+func isComparable(data any) bool {
+	return data == nil || reflect.TypeOf(data).Comparable()
+}
+
+// ProcessErr implements the Queue interface.
+func (q *queue) ProcessErr(callback func(any) error) error {
 	element, ok := q.Next()
 
 	for ok {
-		callback(element)
+		err := callback(element)
+		q.releaseData(element)
+		if err != nil {
+			return err
+		}
 		element, ok = q.Next()
 	}
+	return nil
+}
+
+// ProcessConcurrent implements the Queue interface.
+func (q *queue) ProcessConcurrent(workers int, callback func(any)) {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			q.Process(callback)
+		}()
+	}
+	wg.Wait()
+}
+
+// Flush implements the Queue interface.
+func (q *queue) Flush(callback func(any)) {
+	for _, data := range q.DrainAll() {
+		callback(data)
+		q.releaseData(data)
+	}
+}
+
+// DrainAll implements the Queue interface.
+func (q *queue) DrainAll() []any {
+	q.Lock()
+	defer q.unlock()
+
+	return q.drainAll()
+}
+
+func (q *queue) drainAll() []any {
+	results := make([]any, 0, q.store.len())
+	q.store.walk(func(e element) bool {
+		q.dequeue(e)
+		results = append(results, e.data)
+		return true
+	})
+
+	q.clear()
+	return results
+}
+
+// DrainPriority implements the Queue interface.
+func (q *queue) DrainPriority(priority QueuePriority) []any {
+	q.Lock()
+	defer q.unlock()
+
+	results := make([]any, 0, q.store.lenPriority(priority))
+	for {
+		e, ok := q.store.popPriority(priority)
+		if !ok {
+			break
+		}
+		q.dequeue(e)
+		results = append(results, e.data)
+	}
+
+	q.syncSignal()
+	return results
+}
+
+// DrainFunc implements the Queue interface.
+func (q *queue) DrainFunc(pred func(any) bool) []any {
+	q.Lock()
+	defer q.unlock()
+
+	removed := q.store.remove(func(e element) bool {
+		return pred(e.data)
+	}, 0)
+
+	results := make([]any, 0, len(removed))
+	for _, e := range removed {
+		q.dequeue(e)
+		results = append(results, e.data)
+	}
+
+	q.syncSignal()
+	return results
+}
+
+// DrainTo implements the Queue interface.
+func (q *queue) DrainTo(ch chan<- any) int {
+	results := q.DrainAll()
+
+	for _, data := range results {
+		ch <- data
+	}
+	return len(results)
+}
+
+// Split implements the Queue interface.
+func (q *queue) Split(pred func(any) bool) (Queue, Queue) {
+	q.Lock()
+	defer q.unlock()
+
+	match, rest := newQueue(q.store.empty()), newQueue(q.store.empty())
+	if q.stamps != nil {
+		// the enqueue times move along with the data
+		match.stamped, match.stamps = true, newSideTable[time.Time]()
+		rest.stamped, rest.stamps = true, newSideTable[time.Time]()
+	}
+	for _, e := range q.store.remove(func(element) bool { return true }, 0) {
+		stamp := q.stamps.get(e.id)
+		q.dequeue(e)
+
+		dst := rest
+		if pred(e.data) {
+			dst = match
+		}
+		_ = dst.pushElement(e, stamp)
+	}
+	q.syncSignal()
+
+	match.syncSignal()
+	rest.syncSignal()
+	return match, rest
+}
+
+// Merge implements the Queue interface.
+func (q *queue) Merge(other Queue) {
+	o, ok := other.(interface{ base() *queue })
+	if !ok {
+		q.mergeLevels(other)
+		return
+	}
+
+	src := o.base()
+	if src == q {
+		return
+	}
+
+	first, second := q, src
+	if reflect.ValueOf(src).Pointer() < reflect.ValueOf(q).Pointer() {
+		first, second = src, q
+	}
+	first.Lock()
+	second.Lock()
+	defer unlockBoth(src, q)
+
+	// the data of other is left in place, since a closed Queue discards it
+	if q.closed {
+		return
+	}
+
+	moved := src.store.remove(func(element) bool { return true }, 0)
+	stamps := make([]time.Time, len(moved))
+	for i, e := range moved {
+		stamps[i] = src.stamps.get(e.id)
+		src.dequeue(e)
+	}
+	src.syncSignal()
+
+	if len(moved) == 0 {
+		return
+	}
+
+	var pushed bool
+	for i, e := range moved {
+		if q.pushElement(e, stamps[i]) {
+			pushed = true
+		}
+	}
+	if pushed {
+		q.notify()
+	}
+}
+
+// mergeLevels moves the data from other one element at a time, in the order it is served,
+// since the lock of other cannot be held for the whole move. Every priority held by other
+// is reached, including those outside the levels of the Queue.
+func (q *queue) mergeLevels(other Queue) {
+	for !q.IsClosed() {
+		data, p, ok := other.NextWithPriority()
+		if !ok {
+			return
+		}
+		q.merge(data, p)
+	}
+}
+
+// merge appends the data moved from another Queue, which is not intercepted.
+func (q *queue) merge(data any, priority QueuePriority) {
+	q.Lock()
+	defer q.unlock()
+
+	if !q.closed && q.pushElement(element{data: data, priority: priority}, q.stamp()) {
+		q.notify()
+	}
+}
+
+// base returns the queue, which allows Merge to find it within the types embedding it.
+func (q *queue) base() *queue {
+	return q
+}
+
+// Clear implements the Queue interface.
+func (q *queue) Clear() {
+	q.Lock()
+	defer q.unlock()
+
+	q.clear()
+}
+
+// Trim implements the Queue interface.
+func (q *queue) Trim(limit int) []any {
+	q.Lock()
+	defer q.unlock()
+
+	var dropped []any
+	for q.store.len() > limit {
+		e, ok := q.store.evict(EvictOldestLow, QueuePriority(math.MaxInt))
+		if !ok {
+			break
+		}
+		dropped = append(dropped, e.data)
+	}
+
+	q.syncSignal()
+	if dropped == nil {
+		return []any{}
+	}
+	return dropped
+}
+
+// Reset implements the Queue interface.
+func (q *queue) Reset() {
+	q.Lock()
+	defer q.unlock()
+
+	q.reset()
+}
+
+func (q *queue) reset() {
+	q.store.clear()
+	q.stamps.clear()
+	q.seq = 0
+	q.appended = 0
+	q.dequeued = 0
+	// the held slots are returned, so syncSignal admits the blocked producers
+	q.reserved.Store(0)
+	if q.waits != nil {
+		*q.waits = waitStats{}
+	}
+	if q.depth != nil {
+		q.depth.samples = nil
+		q.depth.next = 0
+	}
+	q.syncSignal()
+}
+
+func (q *queue) clear() {
+	q.store.clear()
+	q.stamps.clear()
+	q.syncSignal()
+}
+
+// ShrinkToFit implements the Queue interface.
+func (q *queue) ShrinkToFit() {
+	q.Lock()
+	defer q.Unlock()
+
+	q.store.compact()
 }
 
 // Empty implements the Queue interface.
@@ -197,16 +1902,93 @@ func (q *queue) Empty() bool {
 
 // Len implements the Queue interface.
 func (q *queue) Len() int {
+	if !q.lazy {
+		return int(q.length.Load())
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	return q.store.len()
+}
+
+// WaitUntilEmpty implements the Queue interface.
+func (q *queue) WaitUntilEmpty(ctx context.Context) error {
+	q.Lock()
+	if q.store.len() == 0 {
+		q.Unlock()
+		return nil
+	}
+	if q.emptied == nil {
+		q.emptied = make(chan struct{})
+	}
+	emptied := q.emptied
+	q.Unlock()
+
+	select {
+	case <-emptied:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LenPriority implements the Queue interface.
+func (q *queue) LenPriority(priority QueuePriority) int {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.store.lenPriority(priority)
+}
+
+// CountByPriority implements the Queue interface.
+func (q *queue) CountByPriority() map[QueuePriority]int {
+	q.Lock()
+	defer q.Unlock()
+
+	counts := make(map[QueuePriority]int, numLevels)
+	q.store.eachLevel(func(p QueuePriority, n int) {
+		counts[p] = n
+	})
+	return counts
+}
+
+// IsClosed implements the Queue interface.
+func (q *queue) IsClosed() bool {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.closed
+}
+
+// Close implements the Queue interface.
+func (q *queue) Close() {
 	q.Lock()
 	defer q.Unlock()
 
-	return q.lenWithoutLock()
+	q.close()
+}
+
+// CloseAndDrain implements the Queue interface.
+func (q *queue) CloseAndDrain() []any {
+	q.Lock()
+	defer q.unlock()
+
+	results := q.drainAll()
+	q.close()
+	return results
 }
 
-func (q *queue) lenWithoutLock() int {
-	qlen := len(q.low)
-	qlen += len(q.norm)
-	qlen += len(q.high)
-	qlen += len(q.crit)
-	return qlen
+func (q *queue) close() {
+	if !q.closed {
+		q.drain()
+		q.closed = true
+		close(q.signal)
+		q.stopDebounce()
+		q.stopSampling()
+		q.stopPromotion()
+		q.releaseProducers(ErrClosed)
+		q.closeWatchers()
+		q.closePrioritySignals()
+	}
 }
@@ -5,6 +5,10 @@
 package queue
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -33,6 +37,36 @@ func TestAppend(t *testing.T) {
 	}
 }
 
+func TestAppendIf(t *testing.T) {
+	q := NewQueue()
+	absent := func(data any) func(Queue) bool {
+		return func(view Queue) bool { return !view.Contains(data) }
+	}
+
+	if !q.AppendIf("first", PriorityHigh, absent("first")) {
+		t.Errorf("AppendIf failed to add data when the condition held")
+	}
+	if q.AppendIf("first", PriorityHigh, absent("first")) {
+		t.Errorf("AppendIf added data when the condition failed")
+	}
+	q.AppendPriority("low", PriorityLow)
+
+	q.AppendIf("second", PriorityNormal, func(view Queue) bool {
+		if have := view.Snapshot(); len(have) != 2 || have[0] != "first" || have[1] != "low" {
+			t.Errorf("the view held %v instead of the queued data in order", have)
+		}
+		if view.LenPriority(PriorityHigh) != 1 {
+			t.Errorf("the view failed to keep the priority of the data")
+		}
+		// changing the view leaves the queue unchanged
+		view.Clear()
+		return true
+	})
+	if l := q.Len(); l != 3 {
+		t.Errorf("expected three elements after AppendIf, got %d", l)
+	}
+}
+
 func TestAppendPriority(t *testing.T) {
 	q := NewQueue()
 
@@ -62,6 +96,67 @@ func TestAppendPriority(t *testing.T) {
 	}
 }
 
+func TestAppendAll(t *testing.T) {
+	q := NewQueue()
+
+	q.Append("norm")
+	q.AppendAll([]any{"high1", "high2", "high3"}, PriorityHigh)
+	if l := q.LenPriority(PriorityHigh); l != 3 {
+		t.Errorf("expected 3 elements at PriorityHigh, got %d", l)
+	}
+
+	select {
+	case <-q.Signal():
+	default:
+		t.Errorf("AppendAll did not fire the signal")
+	}
+
+	for _, want := range []string{"high1", "high2", "high3", "norm"} {
+		if have, _ := q.Next(); want != have {
+			t.Errorf("element popped out of order, expected '%s' but got '%s'", want, have)
+		}
+	}
+}
+
+func TestWeightedQueue(t *testing.T) {
+	q := NewWeightedQueue(map[QueuePriority]int{
+		PriorityCritical: 4,
+		PriorityHigh:     3,
+		PriorityNormal:   2,
+		PriorityLow:      1,
+	})
+
+	for i := 0; i < 10; i++ {
+		q.AppendPriority("low", PriorityLow)
+		q.AppendPriority("norm", PriorityNormal)
+		q.AppendPriority("high", PriorityHigh)
+		q.AppendPriority("crit", PriorityCritical)
+	}
+
+	expected := []string{
+		"crit", "crit", "crit", "crit", "high", "high", "high", "norm", "norm", "low",
+		"crit", "crit", "crit", "crit", "high", "high", "high", "norm", "norm", "low",
+	}
+	for i, want := range expected {
+		if e, _ := q.Peek(); e.(string) != want {
+			t.Errorf("Peek at index %d returned '%s' instead of '%s'", i, e.(string), want)
+		}
+		if have, _ := q.Next(); have.(string) != want {
+			t.Errorf("element %d popped out of weighted order, expected '%s' but got '%s'", i, want, have)
+		}
+	}
+
+	// Empty levels must not waste the weight of the round
+	q.Clear()
+	q.AppendAll([]any{"low1", "low2"}, PriorityLow)
+	q.AppendAll([]any{"crit1", "crit2", "crit3", "crit4", "crit5"}, PriorityCritical)
+	for _, want := range []string{"crit1", "crit2", "crit3", "crit4", "low1", "crit5", "low2"} {
+		if have, _ := q.Next(); have.(string) != want {
+			t.Errorf("element popped out of weighted order, expected '%s' but got '%s'", want, have)
+		}
+	}
+}
+
 func TestSignal(t *testing.T) {
 	q := NewQueue()
 	times := 1000
@@ -108,6 +203,236 @@ func TestNext(t *testing.T) {
 	}
 }
 
+func TestTryNext(t *testing.T) {
+	q := NewQueue()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		if _, ok := q.TryNext(); ok {
+			t.Errorf("an empty Queue claimed to return an element")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TryNext blocked on an empty Queue")
+	}
+
+	q.Append("first")
+	q.Append("second")
+	if e, ok := q.TryNext(); !ok || e.(string) != "first" {
+		t.Errorf("TryNext did not return the front of the Queue")
+	}
+	select {
+	case <-q.Signal():
+	default:
+		t.Errorf("the signal was not asserted while data remained on the Queue")
+	}
+}
+
+func TestNextContext(t *testing.T) {
+	q := NewQueue()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, ok, err := q.NextContext(ctx); ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("an empty Queue did not return the context error, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Append("delayed")
+	}()
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel2()
+	if e, ok, err := q.NextContext(ctx2); !ok || err != nil || e.(string) != "delayed" {
+		t.Errorf("failed to return the element appended while waiting: %v", err)
+	}
+
+	// Only one of the concurrent callers should receive the single element
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var received int
+	ctx3, cancel3 := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel3()
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, ok, _ := q.NextContext(ctx3); ok {
+				mu.Lock()
+				received++
+				mu.Unlock()
+			}
+		}()
+	}
+	q.Append("single")
+	wg.Wait()
+	if received != 1 {
+		t.Errorf("expected exactly one caller to receive the element, got %d", received)
+	}
+}
+
+func TestNextPriority(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendPriority("low1", PriorityLow)
+	q.AppendPriority("low2", PriorityLow)
+	for _, want := range []string{"low1", "low2"} {
+		if have, ok := q.NextPriority(PriorityLow); !ok || have.(string) != want {
+			t.Errorf("NextPriority returned '%v' instead of '%s'", have, want)
+		}
+	}
+	if _, ok := q.NextPriority(PriorityLow); ok {
+		t.Errorf("NextPriority claimed to return an element from an empty level")
+	}
+
+	select {
+	case <-q.Signal():
+	default:
+		t.Errorf("the signal was not asserted while the PriorityCritical element remained")
+	}
+	if _, ok := q.NextPriority(PriorityCritical); !ok {
+		t.Errorf("NextPriority failed to return the PriorityCritical element")
+	}
+	select {
+	case <-q.Signal():
+		t.Errorf("the signal remained asserted after the Queue was emptied")
+	default:
+	}
+}
+
+func TestNextN(t *testing.T) {
+	q := NewQueue()
+
+	if e := q.NextN(3); e == nil || len(e) != 0 {
+		t.Errorf("an empty Queue did not return an empty slice")
+	}
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("norm", PriorityNormal)
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendPriority("high", PriorityHigh)
+	expected := []string{"crit", "high", "norm"}
+	elements := q.NextN(len(expected))
+	if len(elements) != len(expected) {
+		t.Fatalf("expected %d elements, got %d", len(expected), len(elements))
+	}
+	for i, want := range expected {
+		if have := elements[i].(string); have != want {
+			t.Errorf("element %d popped out of priority order, expected '%s' but got '%s'", i, want, have)
+		}
+	}
+
+	if e := q.NextN(5); len(e) != 1 || e[0].(string) != "low" {
+		t.Errorf("failed to return the remaining element when fewer than n were available")
+	}
+	if !q.Empty() {
+		t.Errorf("expected the queue to be empty after popping inserted elements, but it still has %d elements", q.Len())
+	}
+}
+
+func TestQueuePriority(t *testing.T) {
+	names := map[QueuePriority]string{
+		PriorityLow:       "Low",
+		PriorityNormal:    "Normal",
+		PriorityHigh:      "High",
+		PriorityCritical:  "Critical",
+		QueuePriority(7):  "QueuePriority(7)",
+		QueuePriority(-1): "QueuePriority(-1)",
+	}
+	for p, want := range names {
+		if have := p.String(); have != want {
+			t.Errorf("expected the priority name '%s', got '%s'", want, have)
+		}
+		if valid := p >= PriorityLow && p <= PriorityCritical; p.Valid() != valid {
+			t.Errorf("Valid returned %t for priority %d", p.Valid(), int(p))
+		}
+	}
+
+	// Invalid priorities are appended at the nearest level instead of being lost
+	q := NewQueue()
+	q.AppendPriority("above", QueuePriority(7))
+	q.AppendPriority("below", QueuePriority(-3))
+	if q.LenPriority(PriorityCritical) != 1 || q.LenPriority(PriorityLow) != 1 {
+		t.Errorf("the invalid priorities were not clamped to the nearest level")
+	}
+	for _, want := range []string{"above", "below"} {
+		if have, ok := q.Next(); !ok || have != want {
+			t.Errorf("expected '%s' but got '%v'", want, have)
+		}
+	}
+}
+
+func TestPeekN(t *testing.T) {
+	q := NewQueue()
+
+	if have := q.PeekN(3); len(have) != 0 {
+		t.Errorf("PeekN on an empty queue returned %d elements", len(have))
+	}
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("high", PriorityHigh)
+	q.AppendPriority("normal", PriorityNormal)
+
+	have := q.PeekN(2)
+	if len(have) != 2 || have[0] != "high" || have[1] != "normal" {
+		t.Errorf("PeekN returned %v instead of the next two elements in order", have)
+	}
+	if all := q.PeekN(10); len(all) != 3 {
+		t.Errorf("PeekN returned %d elements instead of the three available", len(all))
+	}
+	if q.Len() != 3 {
+		t.Errorf("PeekN changed the length of the queue to %d", q.Len())
+	}
+}
+
+func TestPeekAt(t *testing.T) {
+	q := NewQueue()
+
+	if data, ok := q.PeekAt(0); ok || data != nil {
+		t.Errorf("PeekAt returned '%v' from an empty queue", data)
+	}
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("high", PriorityHigh)
+	q.Append("normal")
+	for i, want := range []string{"high", "normal", "low"} {
+		if have, ok := q.PeekAt(i); !ok || have != want {
+			t.Errorf("PeekAt(%d) returned '%v' instead of '%s'", i, have, want)
+		}
+	}
+	for _, index := range []int{-1, 3} {
+		if data, ok := q.PeekAt(index); ok || data != nil {
+			t.Errorf("PeekAt(%d) returned '%v' for an index outside of the queue", index, data)
+		}
+	}
+	if l := q.Len(); l != 3 {
+		t.Errorf("expected PeekAt to leave 3 elements on the queue, got %d", l)
+	}
+}
+
+func TestPeekPriority(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendPriority("low1", PriorityLow)
+	q.AppendPriority("low2", PriorityLow)
+	if e, ok := q.PeekPriority(PriorityLow); !ok || e.(string) != "low1" {
+		t.Errorf("PeekPriority did not return the front of the PriorityLow level")
+	}
+	if _, ok := q.PeekPriority(PriorityNormal); ok {
+		t.Errorf("PeekPriority claimed to return an element from an empty level")
+	}
+	if l := q.Len(); l != 3 {
+		t.Errorf("PeekPriority changed the length of the Queue to %d", l)
+	}
+}
+
 func TestProcess(t *testing.T) {
 	q := NewQueue()
 	set := stringset.New("element1", "element2")
@@ -135,111 +460,1412 @@ func TestProcess(t *testing.T) {
 	}
 }
 
-func TestEmpty(t *testing.T) {
+func TestProcessReentrant(t *testing.T) {
 	q := NewQueue()
 
+	q.Append(3)
+	var processed []int
+	q.Process(func(data any) {
+		n := data.(int)
+		processed = append(processed, n)
+		// the data appended by the callback is handled by the same call
+		if n > 0 {
+			q.AppendPriority(n-1, PriorityHigh)
+			q.AppendPriority(-n, PriorityLow)
+		}
+	})
+
+	expected := []int{3, 2, 1, 0, -3, -2, -1}
+	if len(processed) != len(expected) {
+		t.Fatalf("expected %d elements to be processed, got %v", len(expected), processed)
+	}
+	for i, want := range expected {
+		if processed[i] != want {
+			t.Errorf("element %d was processed as %d instead of %d", i, processed[i], want)
+		}
+	}
 	if !q.Empty() {
-		t.Errorf("a new Queue did not claim to be empty")
+		t.Errorf("the queue was not empty after executing the Process method")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	q := NewQueue()
+
+	if e := q.Snapshot(); e == nil || len(e) != 0 {
+		t.Errorf("an empty Queue did not return an empty slice")
 	}
 
-	q.Append("testing")
-	if q.Empty() {
-		t.Errorf("a queue with elements claimed to be empty")
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("norm", PriorityNormal)
+	q.AppendPriority("crit", PriorityCritical)
+	snapshot := q.Snapshot()
+	snapshot[0] = "corrupted"
+
+	for _, want := range []string{"crit", "norm", "low"} {
+		if have, _ := q.Next(); have.(string) != want {
+			t.Errorf("element popped out of order after Snapshot, expected '%s' but got '%s'", want, have)
+		}
+	}
+
+	// The snapshot of a weighted Queue must follow the weighted dequeue order
+	w := NewWeightedQueue(map[QueuePriority]int{PriorityCritical: 2, PriorityLow: 1})
+	w.AppendAll([]any{"low1", "low2"}, PriorityLow)
+	w.AppendAll([]any{"crit1", "crit2", "crit3"}, PriorityCritical)
+	snapshot = w.Snapshot()
+	for i, want := range []string{"crit1", "crit2", "low1", "crit3", "low2"} {
+		if snapshot[i].(string) != want {
+			t.Errorf("snapshot element %d was '%s' instead of '%s'", i, snapshot[i].(string), want)
+		}
+		if have, _ := w.Next(); have.(string) != want {
+			t.Errorf("element %d popped out of weighted order, expected '%s' but got '%s'", i, want, have)
+		}
 	}
 }
 
-func TestLen(t *testing.T) {
+func TestForEach(t *testing.T) {
 	q := NewQueue()
 
-	if l := q.Len(); l != 0 {
-		t.Errorf("a new Queue returned a length of %d instead of zero", l)
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("norm", PriorityNormal)
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendPriority("high", PriorityHigh)
+
+	var visited []string
+	q.ForEach(func(data any) bool {
+		visited = append(visited, data.(string))
+		return true
+	})
+	expected := []string{"crit", "high", "norm", "low"}
+	if len(visited) != len(expected) {
+		t.Fatalf("expected %d elements to be visited, got %d", len(expected), len(visited))
+	}
+	for i, want := range expected {
+		if visited[i] != want {
+			t.Errorf("element %d was visited out of order, expected '%s' but got '%s'", i, want, visited[i])
+		}
 	}
 
-	q.Append("testing")
-	if l := q.Len(); l != 1 {
-		t.Errorf("a Queue with elements returned a length of %d instead of one", l)
+	var count int
+	q.ForEach(func(data any) bool {
+		count++
+		return count < 2
+	})
+	if count != 2 {
+		t.Errorf("ForEach did not stop once the callback returned false")
+	}
+	if l := q.Len(); l != len(expected) {
+		t.Errorf("ForEach changed the length of the Queue to %d", l)
+	}
+	if e, _ := q.Next(); e.(string) != "crit" {
+		t.Errorf("ForEach changed the front of the Queue to '%s'", e.(string))
 	}
 }
 
-func BenchmarkAppend(b *testing.B) {
+func TestRemove(t *testing.T) {
 	q := NewQueue()
 
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		q.Append("testing")
+	q.AppendPriority("dup", PriorityLow)
+	q.AppendPriority("keep", PriorityNormal)
+	q.AppendPriority("dup", PriorityHigh)
+	q.AppendPriority([]string{"slice"}, PriorityNormal)
+	if !q.Remove("dup") {
+		t.Errorf("Remove failed to find an element on the Queue")
+	}
+	if q.Remove("missing") {
+		t.Errorf("Remove claimed to delete an element that was not on the Queue")
+	}
+	if q.Remove([]string{"slice"}) {
+		t.Errorf("Remove claimed to match a value that is not comparable")
+	}
+	if l := q.Len(); l != 3 {
+		t.Errorf("expected 3 elements after Remove, got %d", l)
 	}
-	b.StopTimer()
 
-	if e, _ := q.Next(); e != "testing" {
-		b.Errorf("the element was appended as %s instead of 'testing'", e.(string))
+	// Only the first match in dequeue order is removed
+	if l := q.LenPriority(PriorityHigh); l != 0 {
+		t.Errorf("Remove did not delete the first match in dequeue order")
 	}
-	if want, have := b.N-1, q.Len(); want != have {
-		b.Errorf("expected %d elements left on the queue, got %d", want, have)
+	if e, _ := q.Next(); e.(string) != "keep" {
+		t.Errorf("Remove changed the order of the remaining elements")
 	}
 }
 
-func BenchmarkAppendPriority(b *testing.B) {
+func TestRemoveFunc(t *testing.T) {
+	type job struct {
+		tenant string
+		tags   []string
+	}
+
 	q := NewQueue()
+	q.AppendPriority(&job{tenant: "x"}, PriorityLow)
+	q.AppendPriority(&job{tenant: "y", tags: []string{"first"}}, PriorityNormal)
+	q.AppendPriority(&job{tenant: "x"}, PriorityCritical)
+	q.AppendPriority(&job{tenant: "y", tags: []string{"second"}}, PriorityNormal)
 
-	values := []struct {
-		token    string
+	if n := q.RemoveFunc(func(data any) bool { return data.(*job).tenant == "x" }); n != 2 {
+		t.Errorf("expected 2 elements to be removed, got %d", n)
+	}
+	for _, want := range []string{"first", "second"} {
+		if e, _ := q.Next(); e.(*job).tags[0] != want {
+			t.Errorf("RemoveFunc changed the order of the remaining elements")
+		}
+	}
+
+	q.Append(&job{tenant: "x"})
+	if n := q.RemoveFunc(func(data any) bool { return true }); n != 1 {
+		t.Errorf("expected 1 element to be removed, got %d", n)
+	}
+	select {
+	case <-q.Signal():
+		t.Errorf("the signal remained asserted after RemoveFunc emptied the Queue")
+	default:
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("crit1", PriorityCritical)
+	q.AppendPriority("low1", PriorityLow)
+	q.AppendPriority("high1", PriorityHigh)
+	q.AppendPriority("crit2", PriorityCritical)
+	q.AppendPriority("norm1", PriorityNormal)
+
+	// demote everything by one level, and push the lowest level beyond the valid range
+	q.Rebalance(func(data any, current QueuePriority) QueuePriority {
+		return current - 1
+	})
+
+	expected := []struct {
+		data     string
 		priority QueuePriority
 	}{
-		{"valueLow", PriorityLow},
-		{"valueNormal", PriorityNormal},
-		{"valueHigh", PriorityHigh},
-		{"valueCritical", PriorityCritical},
+		{"crit1", PriorityHigh},
+		{"crit2", PriorityHigh},
+		{"high1", PriorityNormal},
+		{"low1", PriorityLow},
+		{"norm1", PriorityLow},
 	}
-
-	topIdx := -1
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		idx := i % len(values)
-		q.AppendPriority(values[idx].token, values[idx].priority)
-		if topIdx < idx {
-			topIdx = idx
+	for _, want := range expected {
+		if data, priority, ok := q.NextWithPriority(); !ok || data != want.data || priority != want.priority {
+			t.Errorf("expected '%s' at %s, got '%v' at %s", want.data, want.priority, data, priority)
 		}
 	}
-	b.StopTimer()
+	if !q.Empty() {
+		t.Errorf("Rebalance changed the number of elements on the queue")
+	}
+}
 
-	if e, _ := q.Next(); topIdx > -1 && e != values[topIdx].token {
-		b.Errorf("the element was appended as %s instead of %s", e.(string), values[topIdx].token)
+func TestMoveAll(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("low1", PriorityLow)
+	q.AppendPriority("norm1", PriorityNormal)
+	q.AppendPriority("low2", PriorityLow)
+	if n := q.MoveAll(PriorityLow, QueuePriority(9)); n != 0 {
+		t.Errorf("MoveAll moved %d elements to an invalid level", n)
 	}
-	if want, have := b.N-1, q.Len(); want != have {
-		b.Errorf("expected %d elements left on the queue, got %d", want, have)
+	if n := q.MoveAll(PriorityLow, PriorityNormal); n != 2 {
+		t.Errorf("MoveAll moved %d elements instead of two", n)
+	}
+	if q.LenPriority(PriorityLow) != 0 || q.LenPriority(PriorityNormal) != 3 {
+		t.Errorf("MoveAll failed to move every element at the level")
+	}
+	for _, want := range []string{"norm1", "low1", "low2"} {
+		if have, _ := q.Next(); have != want {
+			t.Errorf("element popped out of order, expected '%s' but got '%v'", want, have)
+		}
 	}
 }
 
-func BenchmarkNext(b *testing.B) {
+func TestContains(t *testing.T) {
 	q := NewQueue()
-	for i := 0; i < b.N; i++ {
-		q.Append("testing")
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendPriority([]int{1}, PriorityNormal)
+	if !q.Contains("low") || !q.Contains("crit") {
+		t.Errorf("Contains failed to find an element on the Queue")
+	}
+	if q.Contains("missing") || q.Contains([]int{1}) {
+		t.Errorf("Contains matched an element that is not on the Queue")
 	}
 
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		_, _ = q.Next()
+	if !q.ContainsFunc(func(data any) bool {
+		s, ok := data.([]int)
+		return ok && len(s) == 1 && s[0] == 1
+	}) {
+		t.Errorf("ContainsFunc failed to find the non-comparable element")
 	}
-	b.StopTimer()
+	if q.ContainsFunc(func(data any) bool { return false }) {
+		t.Errorf("ContainsFunc matched when the predicate never returned true")
+	}
+	if l := q.Len(); l != 3 {
+		t.Errorf("Contains changed the length of the Queue to %d", l)
+	}
+}
 
-	if have := q.Len(); have != 0 {
-		b.Errorf("expected 0 elements left on the queue, got %d", have)
+func TestUpdatePriority(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("norm", PriorityNormal)
+	if !q.UpdatePriority("low", PriorityCritical) {
+		t.Errorf("UpdatePriority failed to move an element on the Queue")
+	}
+	if q.UpdatePriority("missing", PriorityHigh) || q.UpdatePriority("norm", QueuePriority(10)) {
+		t.Errorf("UpdatePriority claimed to move an element it should not")
+	}
+	if l := q.Len(); l != 3 {
+		t.Errorf("expected 3 elements after UpdatePriority, got %d", l)
+	}
+
+	// The moved element goes to the back of its new level
+	for _, want := range []string{"crit", "low", "norm"} {
+		if have, _ := q.Next(); have.(string) != want {
+			t.Errorf("element popped out of order, expected '%s' but got '%s'", want, have)
+		}
 	}
 }
 
-func BenchmarkProcess(b *testing.B) {
+func TestDrainAll(t *testing.T) {
 	q := NewQueue()
-	for i := 0; i < b.N; i++ {
-		q.Append("testing")
+
+	if e := q.DrainAll(); e == nil || len(e) != 0 {
+		t.Errorf("an empty Queue did not return an empty slice")
 	}
 
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		q.Process(func(e interface{}) {})
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("norm1", PriorityNormal)
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendPriority("norm2", PriorityNormal)
+	expected := []string{"crit", "norm1", "norm2", "low"}
+	elements := q.DrainAll()
+	if len(elements) != len(expected) {
+		t.Fatalf("expected %d elements, got %d", len(expected), len(elements))
+	}
+	for i, want := range expected {
+		if have := elements[i].(string); have != want {
+			t.Errorf("element %d drained out of order, expected '%s' but got '%s'", i, want, have)
+		}
 	}
-	b.StopTimer()
 
-	if have := q.Len(); have != 0 {
-		b.Errorf("expected 0 elements left on the queue, got %d", have)
+	if !q.Empty() {
+		t.Errorf("expected the queue to be empty after DrainAll, but it still has %d elements", q.Len())
 	}
+	select {
+	case <-q.Signal():
+		t.Errorf("the signal remained asserted after the Queue was drained")
+	default:
+	}
+}
+
+func TestDrainPriority(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("crit1", PriorityCritical)
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("crit2", PriorityCritical)
+
+	have := q.DrainPriority(PriorityCritical)
+	if len(have) != 2 || have[0] != "crit1" || have[1] != "crit2" {
+		t.Errorf("DrainPriority returned %v instead of the critical elements in order", have)
+	}
+	if len(q.DrainPriority(PriorityHigh)) != 0 {
+		t.Errorf("DrainPriority returned data from an empty level")
+	}
+	select {
+	case <-q.Signal():
+	default:
+		t.Errorf("the signal was not asserted while another level holds data")
+	}
+	if have, _ := q.Next(); have != "low" {
+		t.Errorf("DrainPriority changed the other levels")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("crit", PriorityCritical)
+	q.Append("norm")
+
+	var flushed []string
+	q.Flush(func(data any) {
+		flushed = append(flushed, data.(string))
+		// data appended during the flush waits for the next round
+		q.Append("late")
+	})
+
+	expected := []string{"crit", "norm", "low"}
+	if len(flushed) != len(expected) {
+		t.Fatalf("expected %d elements to be flushed, got %d", len(expected), len(flushed))
+	}
+	for i, want := range expected {
+		if flushed[i] != want {
+			t.Errorf("element %d flushed out of order, expected '%s' but got '%s'", i, want, flushed[i])
+		}
+	}
+	if l := q.Len(); l != 3 {
+		t.Errorf("expected the 3 elements appended during the flush to remain, got %d", l)
+	}
+}
+
+func TestDrainFunc(t *testing.T) {
+	q := NewQueue()
+
+	if e := q.DrainFunc(func(any) bool { return true }); e == nil || len(e) != 0 {
+		t.Errorf("an empty Queue did not return an empty slice")
+	}
+
+	q.AppendPriority(1, PriorityLow)
+	q.AppendPriority(2, PriorityNormal)
+	q.AppendPriority(3, PriorityNormal)
+	q.AppendPriority(4, PriorityCritical)
+	q.AppendPriority(5, PriorityNormal)
+
+	even := q.DrainFunc(func(data any) bool { return data.(int)%2 == 0 })
+	for i, want := range []int{4, 2} {
+		if i >= len(even) || even[i] != want {
+			t.Errorf("expected the drained elements to be [4 2], got %v", even)
+			break
+		}
+	}
+	for _, want := range []int{3, 5, 1} {
+		if have, _ := q.Next(); have != want {
+			t.Errorf("expected the remaining element %d, got %v", want, have)
+		}
+	}
+}
+
+func TestDrainTo(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("high", PriorityHigh)
+
+	ch := make(chan any, 2)
+	if n := q.DrainTo(ch); n != 2 || !q.Empty() {
+		t.Errorf("DrainTo sent %d elements and left %d on the queue", n, q.Len())
+	}
+	for _, want := range []string{"high", "low"} {
+		if have := <-ch; have != want {
+			t.Errorf("DrainTo sent '%v' instead of '%s'", have, want)
+		}
+	}
+
+	// the channel is left open for more data
+	ch <- "more"
+	if n := q.DrainTo(ch); n != 0 {
+		t.Errorf("DrainTo sent %d elements from an empty queue", n)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("a-low", PriorityLow)
+	q.AppendPriority("b-high", PriorityHigh)
+	q.AppendPriority("a-high1", PriorityHigh)
+	q.AppendPriority("a-high2", PriorityHigh)
+	q.Append("b-norm")
+
+	match, rest := q.Split(func(data any) bool { return strings.HasPrefix(data.(string), "a-") })
+	if !q.Empty() {
+		t.Errorf("expected the queue to be empty after Split, but it still has %d elements", q.Len())
+	}
+
+	for _, tc := range []struct {
+		q        Queue
+		expected []string
+	}{
+		{match, []string{"a-high1", "a-high2", "a-low"}},
+		{rest, []string{"b-high", "b-norm"}},
+	} {
+		select {
+		case <-tc.q.Signal():
+		default:
+			t.Errorf("the signal was not asserted on a Queue returned by Split")
+		}
+		for _, want := range tc.expected {
+			if have, ok := tc.q.Next(); !ok || have != want {
+				t.Errorf("expected '%s' to be returned after Split, got '%v'", want, have)
+			}
+		}
+		if !tc.q.Empty() {
+			t.Errorf("a Queue returned by Split has %d unexpected elements", tc.q.Len())
+		}
+	}
+
+	// The priorities beyond the four named levels are kept
+	for _, q := range []Queue{NewQueueLevels(8), NewHeapQueue()} {
+		for _, p := range []QueuePriority{7, 5, 3} {
+			q.AppendPriority(p, p)
+		}
+		match, _ := q.Split(func(any) bool { return true })
+		for _, want := range []QueuePriority{7, 5, 3} {
+			if data, have, _ := match.NextWithPriority(); data != want || have != want {
+				t.Errorf("expected %d to keep its priority after Split, got %v at %s", want, data, have)
+			}
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	q := NewQueue()
+	other := NewQueue()
+
+	q.AppendPriority("q-low", PriorityLow)
+	other.AppendPriority("o-low", PriorityLow)
+	other.AppendPriority("o-high", PriorityHigh)
+
+	q.Merge(other)
+	q.Merge(q)
+	if !other.Empty() {
+		t.Errorf("Merge left %d elements on the other queue", other.Len())
+	}
+	if _, ok := <-q.Signal(); !ok || q.Len() != 3 {
+		t.Errorf("the merged queue holds %d elements instead of three", q.Len())
+	}
+	for _, want := range []string{"o-high", "q-low", "o-low"} {
+		if have, _ := q.Next(); have.(string) != want {
+			t.Errorf("element popped out of merged order, expected '%s' but got '%v'", want, have)
+		}
+	}
+
+	// Concurrent merges in opposite directions must not deadlock
+	a, b := NewQueue(), NewQueue()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		a.Append(i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			a.Merge(b)
+		}()
+		go func() {
+			defer wg.Done()
+			b.Merge(a)
+		}()
+	}
+	wg.Wait()
+	if total := a.Len() + b.Len(); total != 100 {
+		t.Errorf("concurrent merges left %d elements instead of 100", total)
+	}
+
+	// A wrapping Queue is drained one element at a time
+	r := NewRateLimitedQueue(NewQueue(), 1)
+	r.AppendPriority("wrapped", PriorityCritical)
+	q.Merge(r)
+	if have, _ := q.PeekPriority(PriorityCritical); !r.Empty() || have != "wrapped" {
+		t.Errorf("Merge failed to move the data from a wrapping queue")
+	}
+
+	// every priority of a wrapped Queue is reached
+	for _, wrapped := range []Queue{NewQueueLevels(8), NewHeapQueue()} {
+		w := NewRateLimitedQueue(wrapped, 0)
+		w.AppendPriority("beyond", QueuePriority(7))
+		NewQueueLevels(8).Merge(w)
+		if l := w.Len(); l != 0 {
+			t.Errorf("Merge left %d elements at the priorities outside the default levels", l)
+		}
+	}
+
+	// the hooks run once neither lock is held
+	hooked := NewQueue()
+	src := NewQueue()
+	hooked.OnAppend(func(any, QueuePriority) { _, _ = src.Peek() })
+	src.OnNext(func(any, QueuePriority) { _, _ = hooked.Peek() })
+	src.Append("hooked")
+	hooked.Merge(src)
+	if hooked.Len() != 1 {
+		t.Errorf("Merge failed to move the data to a Queue with hooks")
+	}
+
+	// A closed Queue leaves the data on other
+	q.Close()
+	other.Append("kept")
+	r.Append("kept")
+	q.Merge(other)
+	q.Merge(r)
+	if other.Len() != 1 || r.Len() != 1 {
+		t.Errorf("Merge into a closed queue removed the data from other")
+	}
+}
+
+func TestClear(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("norm", PriorityNormal)
+	q.AppendPriority("high", PriorityHigh)
+	q.AppendPriority("crit", PriorityCritical)
+	q.Clear()
+	if l := q.Len(); l != 0 {
+		t.Errorf("a cleared Queue returned a length of %d instead of zero", l)
+	}
+
+	select {
+	case <-q.Signal():
+		t.Errorf("the signal remained asserted after the Queue was cleared")
+	default:
+	}
+	if _, ok := q.Next(); ok {
+		t.Errorf("a cleared Queue claimed to return another element")
+	}
+}
+
+func TestProcessContext(t *testing.T) {
+	q := NewQueue()
+	q.AppendAll([]any{"first", "second", "third"}, PriorityNormal)
+
+	var count int
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.ProcessContext(ctx, func(e any) {
+		count++
+		if count == 2 {
+			cancel()
+		}
+	})
+	if count != 2 {
+		t.Errorf("expected 2 elements to be processed before cancellation, got %d", count)
+	}
+	if e, ok := q.Next(); !ok || e.(string) != "third" {
+		t.Errorf("the unprocessed element did not remain on the Queue")
+	}
+}
+
+func TestConsume(t *testing.T) {
+	q := NewQueue()
+	quit := make(chan struct{})
+	received := make(chan any)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Consume(quit, func(data any) { received <- data })
+	}()
+
+	q.Append("first")
+	time.Sleep(10 * time.Millisecond)
+	q.Append("second")
+	for _, want := range []string{"first", "second"} {
+		select {
+		case have := <-received:
+			if have != want {
+				t.Errorf("expected '%s' but got '%v'", want, have)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Consume failed to process '%s'", want)
+		}
+	}
+
+	close(quit)
+	<-done
+	q.Append("remaining")
+	if l := q.Len(); l != 1 {
+		t.Errorf("expected the data appended after quit to remain queued, got a length of %d", l)
+	}
+
+	// a closed and drained Queue also ends Consume
+	q.Close()
+	q.Consume(make(chan struct{}), func(any) {})
+	if !q.Empty() {
+		t.Errorf("Consume returned before draining the closed queue")
+	}
+}
+
+func TestProcessErr(t *testing.T) {
+	q := NewQueue()
+	q.AppendAll([]any{"first", "fail", "third"}, PriorityNormal)
+
+	failure := errors.New("callback failure")
+	var processed []string
+	err := q.ProcessErr(func(e any) error {
+		processed = append(processed, e.(string))
+		if e.(string) == "fail" {
+			return failure
+		}
+		return nil
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("ProcessErr returned %v instead of the callback error", err)
+	}
+	if len(processed) != 2 {
+		t.Errorf("expected processing to stop after 2 elements, got %d", len(processed))
+	}
+	if e, ok := q.Next(); !ok || e.(string) != "third" || !q.Empty() {
+		t.Errorf("only the unprocessed element should remain on the Queue")
+	}
+
+	if err := q.ProcessErr(func(e any) error { return nil }); err != nil {
+		t.Errorf("ProcessErr on an empty Queue returned %v", err)
+	}
+}
+
+func TestProcessConcurrent(t *testing.T) {
+	q := NewQueue()
+	num := 1000
+	for i := 0; i < num; i++ {
+		q.AppendPriority(i, QueuePriority(i%4))
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int]struct{}, num)
+	q.ProcessConcurrent(0, func(e any) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		seen[e.(int)] = struct{}{}
+	})
+	if len(seen) != num {
+		t.Errorf("expected %d elements to be processed, got %d", num, len(seen))
+	}
+	if !q.Empty() {
+		t.Errorf("the queue was not empty after executing the ProcessConcurrent method")
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	q := NewQueue()
+
+	if !q.Empty() {
+		t.Errorf("a new Queue did not claim to be empty")
+	}
+
+	q.Append("testing")
+	if q.Empty() {
+		t.Errorf("a queue with elements claimed to be empty")
+	}
+}
+
+func TestLen(t *testing.T) {
+	q := NewQueue()
+
+	if l := q.Len(); l != 0 {
+		t.Errorf("a new Queue returned a length of %d instead of zero", l)
+	}
+
+	q.Append("testing")
+	if l := q.Len(); l != 1 {
+		t.Errorf("a Queue with elements returned a length of %d instead of one", l)
+	}
+
+	// Len must not wait for the lock
+	q.(*queue).Lock()
+	done := make(chan int)
+	go func() { done <- q.Len() }()
+	select {
+	case l := <-done:
+		if l != 1 {
+			t.Errorf("Len returned %d instead of one while the lock was held", l)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Len blocked while the lock was held")
+	}
+	q.(*queue).Unlock()
+}
+
+func TestWaitUntilEmpty(t *testing.T) {
+	q := NewQueue()
+
+	if err := q.WaitUntilEmpty(context.Background()); err != nil {
+		t.Errorf("an empty Queue returned %v", err)
+	}
+
+	q.Append("first")
+	q.Append("second")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.WaitUntilEmpty(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("a Queue with elements returned %v instead of the context error", err)
+	}
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			time.Sleep(5 * time.Millisecond)
+			_, _ = q.Next()
+		}
+	}()
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel2()
+	if err := q.WaitUntilEmpty(ctx2); err != nil || !q.Empty() {
+		t.Errorf("WaitUntilEmpty returned %v before the Queue was drained", err)
+	}
+}
+
+func TestLenPriority(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("high1", PriorityHigh)
+	q.AppendPriority("high2", PriorityHigh)
+	expected := map[QueuePriority]int{
+		PriorityLow:      1,
+		PriorityNormal:   0,
+		PriorityHigh:     2,
+		PriorityCritical: 0,
+	}
+	for priority, want := range expected {
+		if have := q.LenPriority(priority); have != want {
+			t.Errorf("priority %d returned a length of %d instead of %d", priority, have, want)
+		}
+	}
+}
+
+func TestCountByPriority(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendPriority("norm1", PriorityNormal)
+	q.AppendPriority("norm2", PriorityNormal)
+	counts := q.CountByPriority()
+	expected := map[QueuePriority]int{
+		PriorityLow:      0,
+		PriorityNormal:   2,
+		PriorityHigh:     0,
+		PriorityCritical: 1,
+	}
+	if len(counts) != len(expected) {
+		t.Errorf("expected an entry for each of the %d levels, got %d", len(expected), len(counts))
+	}
+	for priority, want := range expected {
+		if have, found := counts[priority]; !found || have != want {
+			t.Errorf("priority %d returned a count of %d instead of %d", priority, have, want)
+		}
+	}
+}
+
+func TestOnAppendOnNext(t *testing.T) {
+	q := NewQueue()
+
+	var appended, dequeued []QueuePriority
+	q.OnAppend(func(data any, priority QueuePriority) {
+		// the hook is called outside the lock, so it can use the Queue
+		if !q.Contains(data) {
+			t.Errorf("OnAppend was called with '%v' before it was on the queue", data)
+		}
+		appended = append(appended, priority)
+	})
+	q.OnNext(func(data any, priority QueuePriority) {
+		if q.Contains(data) {
+			t.Errorf("OnNext was called with '%v' while it was still on the queue", data)
+		}
+		dequeued = append(dequeued, priority)
+	})
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendAll([]any{"high1", "high2"}, PriorityHigh)
+	q.AppendPriority("crit", PriorityCritical)
+	if len(appended) != 4 {
+		t.Errorf("OnAppend was called %d times instead of four", len(appended))
+	}
+
+	_, _ = q.Next()
+	_ = q.NextN(2)
+	_ = q.DrainAll()
+	expected := []QueuePriority{PriorityCritical, PriorityHigh, PriorityHigh, PriorityLow}
+	if len(dequeued) != len(expected) {
+		t.Fatalf("OnNext was called %d times instead of %d", len(dequeued), len(expected))
+	}
+	for i, want := range expected {
+		if have := dequeued[i]; have != want {
+			t.Errorf("OnNext call %d reported priority %d instead of %d", i, have, want)
+		}
+	}
+
+	q.OnAppend(nil)
+	q.OnNext(nil)
+	q.Append("untracked")
+	_, _ = q.Next()
+	if len(appended) != 4 || len(dequeued) != 4 {
+		t.Errorf("the hooks were called after being removed")
+	}
+}
+
+func TestTrim(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("normal1", PriorityNormal)
+	q.AppendPriority("low1", PriorityLow)
+	q.AppendPriority("high1", PriorityHigh)
+	q.AppendPriority("low2", PriorityLow)
+	if dropped := q.Trim(10); len(dropped) != 0 {
+		t.Errorf("Trim removed %d elements from a queue within the limit", len(dropped))
+	}
+
+	dropped := q.Trim(1)
+	expected := []string{"low1", "low2", "normal1"}
+	if len(dropped) != len(expected) {
+		t.Fatalf("Trim removed %v instead of %v", dropped, expected)
+	}
+	for i, want := range expected {
+		if dropped[i] != want {
+			t.Errorf("Trim removed '%v' instead of '%s'", dropped[i], want)
+		}
+	}
+	if have, _ := q.Next(); q.Len() != 0 || have != "high1" {
+		t.Errorf("Trim failed to keep the highest priority element")
+	}
+
+	h := NewHeapQueue()
+	h.AppendPriority("big", 100)
+	h.AppendPriority("small", -5)
+	if dropped := h.Trim(0); len(dropped) != 2 || dropped[0] != "small" {
+		t.Errorf("Trim failed to empty the heap queue, removing %v", dropped)
+	}
+}
+
+func TestReset(t *testing.T) {
+	q := NewQueue(WithWaitTracking())
+
+	q.AppendAll([]any{"first", "second", "third"}, PriorityNormal)
+	_, _ = q.Next()
+	q.Reset()
+
+	if !q.Empty() {
+		t.Errorf("Reset left %d elements on the queue", q.Len())
+	}
+	if stats := q.Stats(); stats.Appended != 0 || stats.Dequeued != 0 {
+		t.Errorf("Reset left the counters at %d appended and %d dequeued", stats.Appended, stats.Dequeued)
+	}
+	if avg := q.AverageWait(); avg != 0 {
+		t.Errorf("Reset left an average wait of %v", avg)
+	}
+	select {
+	case <-q.Signal():
+		t.Errorf("the signal remained asserted after Reset")
+	default:
+	}
+
+	q.Append("fresh")
+	if have, ok := q.Next(); !ok || have != "fresh" {
+		t.Errorf("the queue was not usable after Reset")
+	}
+}
+
+func TestFIFOWithinPriority(t *testing.T) {
+	type tagged struct {
+		producer int
+		n        int
+	}
+
+	q := NewQueue()
+	producers, perProducer := 8, 4000
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for n := 0; n < perProducer; n++ {
+				q.AppendPriority(tagged{producer: p, n: n}, QueuePriority(n%numLevels))
+			}
+		}(p)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// The consumer removes data while the producers interleave across all the levels
+	var received []any
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		case <-q.Signal():
+		}
+
+		switch len(received) % 3 {
+		case 0:
+			if data, ok := q.Next(); ok {
+				received = append(received, data)
+			}
+		case 1:
+			received = append(received, q.NextN(5)...)
+		default:
+			received = append(received, q.DrainAll()...)
+		}
+	}
+	received = append(received, q.DrainAll()...)
+
+	if len(received) != producers*perProducer {
+		t.Fatalf("expected %d elements, got %d", producers*perProducer, len(received))
+	}
+	last := make(map[[2]int]int)
+	for _, data := range received {
+		e := data.(tagged)
+		key := [2]int{e.producer, e.n % numLevels}
+		if prev, found := last[key]; found && prev > e.n {
+			t.Fatalf("producer %d element %d was removed before element %d of the same level", e.producer, prev, e.n)
+		}
+		last[key] = e.n
+	}
+}
+
+func TestSignalConsistency(t *testing.T) {
+	q := NewQueue()
+	raw := q.(*queue)
+	stop := make(chan struct{})
+
+	// The consumers never receive from the signal channel, so the token must be present
+	// exactly when the Queue holds data, every time the lock is released
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				q.AppendPriority(j, QueuePriority(j%numLevels))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, ok := q.TryNext(); !ok {
+					_ = q.NextN(3)
+				}
+			}
+		}()
+	}
+
+	checks := make(chan struct{})
+	go func() {
+		defer close(checks)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			raw.Lock()
+			if asserted, held := len(raw.signal) == 1, raw.store.len() > 0; asserted != held {
+				t.Errorf("the signal asserted is %t while the queue holding data is %t", asserted, held)
+			}
+			raw.Unlock()
+		}
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	<-checks
+
+	// Consumers waiting on the signal must receive every element without a lost wakeup
+	num := 4000
+	received := make(chan any, num)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	q = NewQueue()
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				data, ok, err := q.NextContext(ctx)
+				if err != nil {
+					return
+				}
+				if ok {
+					received <- data
+				}
+			}
+		}()
+	}
+	for i := 0; i < num; i++ {
+		q.Append(i)
+	}
+	for i := 0; i < num; i++ {
+		select {
+		case <-received:
+		case <-ctx.Done():
+			t.Fatalf("the consumers slept with %d elements left on the queue", q.Len())
+		}
+	}
+}
+
+func TestWaitNext(t *testing.T) {
+	q := NewQueue()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Append("late")
+		time.Sleep(20 * time.Millisecond)
+		q.Close()
+	}()
+
+	if have, ok := q.WaitNext(); !ok || have != "late" {
+		t.Errorf("WaitNext returned '%v' instead of waiting for the element", have)
+	}
+	if _, ok := q.WaitNext(); ok {
+		t.Errorf("WaitNext returned true from a closed and drained queue")
+	}
+}
+
+func TestNextAtLeast(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("normal", PriorityNormal)
+	if _, ok := q.NextAtLeast(PriorityHigh); ok {
+		t.Errorf("NextAtLeast returned data below the minimum priority")
+	}
+
+	q.AppendPriority("high", PriorityHigh)
+	q.AppendPriority("crit", PriorityCritical)
+	for _, want := range []string{"crit", "high"} {
+		if have, ok := q.NextAtLeast(PriorityHigh); !ok || have != want {
+			t.Errorf("expected '%s' but got '%v'", want, have)
+		}
+	}
+	if have, _ := q.NextAtLeast(PriorityLow); have != "normal" || q.Len() != 1 {
+		t.Errorf("NextAtLeast failed to return the front of the queue")
+	}
+}
+
+func TestCompareAndNext(t *testing.T) {
+	q := NewQueue()
+
+	q.Append("head")
+	q.Append("next")
+	if data, ok := q.CompareAndNext("next"); ok || data != nil {
+		t.Errorf("CompareAndNext returned '%v' when the front element did not match", data)
+	}
+	if data, ok := q.CompareAndNext([]string{"head"}); ok || data != nil {
+		t.Errorf("CompareAndNext returned '%v' when expecting data that is not comparable", data)
+	}
+	if data, ok := q.CompareAndNext("head"); !ok || data != "head" {
+		t.Errorf("CompareAndNext returned '%v' instead of the matching front element", data)
+	}
+	if l := q.Len(); l != 1 {
+		t.Errorf("expected one element to remain on the queue, got %d", l)
+	}
+
+	q.AppendPriority([]int{1}, PriorityHigh)
+	if _, ok := q.CompareAndNext("next"); ok {
+		t.Errorf("CompareAndNext matched front data that is not comparable")
+	}
+}
+
+func TestNextFunc(t *testing.T) {
+	q := NewQueue()
+
+	ready := func(data any) bool { return strings.HasPrefix(data.(string), "ready") }
+	if _, ok := q.NextFunc(ready); ok {
+		t.Errorf("NextFunc returned data from an empty queue")
+	}
+
+	q.Append("waiting")
+	q.Append("ready")
+	if data, ok := q.NextFunc(ready); ok || data != nil {
+		t.Errorf("NextFunc returned '%v' when the front element did not match", data)
+	}
+	if l := q.Len(); l != 2 {
+		t.Errorf("NextFunc changed the queue when the front element did not match, length is %d", l)
+	}
+
+	q.AppendPriority("ready first", PriorityHigh)
+	if data, ok := q.NextFunc(ready); !ok || data != "ready first" {
+		t.Errorf("NextFunc returned '%v' instead of the matching front element", data)
+	}
+	if data, _ := q.Peek(); data != "waiting" {
+		t.Errorf("expected 'waiting' to be at the front of the queue, got '%v'", data)
+	}
+}
+
+func TestNextWithPriority(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("high", PriorityHigh)
+	for _, want := range []QueuePriority{PriorityHigh, PriorityLow} {
+		if _, have, ok := q.NextWithPriority(); !ok || have != want {
+			t.Errorf("NextWithPriority returned the priority %s instead of %s", have, want)
+		}
+	}
+	if _, _, ok := q.NextWithPriority(); ok {
+		t.Errorf("NextWithPriority returned data from an empty queue")
+	}
+}
+
+func TestNextWithSeq(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("first", PriorityLow)
+	q.AppendPriority("second", PriorityHigh)
+	q.AppendPriority("third", PriorityLow)
+	for _, want := range []struct {
+		data string
+		seq  uint64
+	}{
+		{"second", 2},
+		{"first", 1},
+		{"third", 3},
+	} {
+		if data, seq, ok := q.NextWithSeq(); !ok || data != want.data || seq != want.seq {
+			t.Errorf("NextWithSeq returned '%v' with the sequence %d instead of '%s' with %d", data, seq, want.data, want.seq)
+		}
+	}
+	if _, _, ok := q.NextWithSeq(); ok {
+		t.Errorf("NextWithSeq returned data from an empty queue")
+	}
+
+	// the sequence number stays with the data moved to another level
+	q.Append("moved")
+	q.Append("kept")
+	q.UpdatePriority("moved", PriorityNormal)
+	q.MoveAll(PriorityNormal, PriorityHigh)
+	for _, want := range []uint64{5, 4} {
+		if _, seq, _ := q.NextWithSeq(); seq != want {
+			t.Errorf("NextWithSeq returned the sequence %d instead of %d for the moved data", seq, want)
+		}
+	}
+}
+
+func TestNextTimeout(t *testing.T) {
+	q := NewQueue()
+
+	start := time.Now()
+	if _, ok := q.NextTimeout(30 * time.Millisecond); ok {
+		t.Errorf("NextTimeout returned data from an empty queue")
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("NextTimeout returned after %v instead of waiting for the timeout", elapsed)
+	}
+
+	q.Append("ready")
+	if have, ok := q.NextTimeout(time.Hour); !ok || have != "ready" {
+		t.Errorf("NextTimeout failed to return the available element")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Append("late")
+	}()
+	if have, ok := q.NextTimeout(5 * time.Second); !ok || have != "late" {
+		t.Errorf("NextTimeout failed to return the element appended while waiting")
+	}
+}
+
+func TestCloseAndDrain(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("high", PriorityHigh)
+
+	elements := q.CloseAndDrain()
+	if !q.IsClosed() {
+		t.Errorf("IsClosed returned false after CloseAndDrain was called")
+	}
+	expected := []string{"high", "low"}
+	if len(elements) != len(expected) {
+		t.Fatalf("expected %d elements, got %d", len(expected), len(elements))
+	}
+	for i, want := range expected {
+		if have := elements[i].(string); have != want {
+			t.Errorf("element %d drained out of order, expected '%s' but got '%s'", i, want, have)
+		}
+	}
+
+	q.Append("late")
+	if !q.Empty() {
+		t.Errorf("a closed Queue accepted new elements, length is %d instead of zero", q.Len())
+	}
+	if _, ok := <-q.Signal(); ok {
+		t.Errorf("the signal channel was not closed")
+	}
+	if e := q.CloseAndDrain(); e == nil || len(e) != 0 {
+		t.Errorf("a closed and drained Queue did not return an empty slice")
+	}
+}
+
+func TestClose(t *testing.T) {
+	q := NewQueue()
+
+	q.Append("first")
+	q.Append("second")
+
+	done := make(chan error, 1)
+	go func() {
+		empty := NewQueue()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			empty.Close()
+		}()
+		_, _, err := empty.NextContext(context.Background())
+		done <- err
+	}()
+
+	if q.IsClosed() {
+		t.Errorf("IsClosed returned true before Close was called")
+	}
+	q.Close()
+	q.Close()
+	if !q.IsClosed() {
+		t.Errorf("IsClosed returned false after Close was called")
+	}
+	q.Append("third")
+	if l := q.Len(); l != 2 {
+		t.Errorf("a closed Queue accepted new elements, length is %d instead of two", l)
+	}
+	if _, ok := <-q.Signal(); ok {
+		t.Errorf("the signal channel was not closed")
+	}
+	for _, want := range []string{"first", "second"} {
+		if have, ok := q.Next(); !ok || have.(string) != want {
+			t.Errorf("a closed Queue failed to return the buffered element %s", want)
+		}
+	}
+	if _, ok := q.Next(); ok {
+		t.Errorf("a closed and drained Queue claimed to return another element")
+	}
+	if _, _, err := q.NextContext(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("NextContext on a closed and drained Queue returned %v instead of ErrClosed", err)
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("a blocked NextContext caller returned %v instead of ErrClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Close did not wake up the blocked NextContext caller")
+	}
+}
+
+func BenchmarkAppend(b *testing.B) {
+	q := NewQueue()
+
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		q.Append("testing")
+	}
+	b.StopTimer()
+
+	if e, _ := q.Next(); e != "testing" {
+		b.Errorf("the element was appended as %s instead of 'testing'", e.(string))
+	}
+	if want, have := b.N-1, q.Len(); want != have {
+		b.Errorf("expected %d elements left on the queue, got %d", want, have)
+	}
+}
+
+func BenchmarkAppendAll(b *testing.B) {
+	q := NewQueue()
+	data := make([]any, b.N)
+	for i := range data {
+		data[i] = "testing"
+	}
+
+	b.StartTimer()
+	q.AppendAll(data, PriorityNormal)
+	b.StopTimer()
+
+	if want, have := b.N, q.Len(); want != have {
+		b.Errorf("expected %d elements on the queue, got %d", want, have)
+	}
+}
+
+func BenchmarkAppendPriority(b *testing.B) {
+	q := NewQueue()
+
+	values := []struct {
+		token    string
+		priority QueuePriority
+	}{
+		{"valueLow", PriorityLow},
+		{"valueNormal", PriorityNormal},
+		{"valueHigh", PriorityHigh},
+		{"valueCritical", PriorityCritical},
+	}
+
+	topIdx := -1
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		idx := i % len(values)
+		q.AppendPriority(values[idx].token, values[idx].priority)
+		if topIdx < idx {
+			topIdx = idx
+		}
+	}
+	b.StopTimer()
+
+	if e, _ := q.Next(); topIdx > -1 && e != values[topIdx].token {
+		b.Errorf("the element was appended as %s instead of %s", e.(string), values[topIdx].token)
+	}
+	if want, have := b.N-1, q.Len(); want != have {
+		b.Errorf("expected %d elements left on the queue, got %d", want, have)
+	}
+}
+
+func BenchmarkNext(b *testing.B) {
+	q := NewQueue()
+	for i := 0; i < b.N; i++ {
+		q.Append("testing")
+	}
+
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = q.Next()
+	}
+	b.StopTimer()
+
+	if have := q.Len(); have != 0 {
+		b.Errorf("expected 0 elements left on the queue, got %d", have)
+	}
+}
+
+func BenchmarkProcess(b *testing.B) {
+	q := NewQueue()
+	for i := 0; i < b.N; i++ {
+		q.Append("testing")
+	}
+
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		q.Process(func(e interface{}) {})
+	}
+	b.StopTimer()
+
+	if have := q.Len(); have != 0 {
+		b.Errorf("expected 0 elements left on the queue, got %d", have)
+	}
+}
+
+func BenchmarkConcurrentProducers(b *testing.B) {
+	q := NewQueue()
+	for i := 0; i < 1000; i++ {
+		q.Append("testing")
+	}
+
+	b.ReportAllocs()
+	b.SetParallelism(8)
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			// producers and consumers share the Queue with monitors reading its state. Every
+			// caller serializes on the lock, whatever its priority, except Len, which reads
+			// the recorded length without it.
+			switch i % 4 {
+			case 0:
+				q.AppendPriority("testing", QueuePriority(i/4%numLevels))
+				_, _ = q.Next()
+			default:
+				_ = q.Len()
+				_, _ = q.Peek()
+			}
+			i++
+		}
+	})
 }
@@ -0,0 +1,162 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimitedQueue wraps a Queue to limit the rate that data leaves through Next, TryNext,
+// NextContext and Process, using a token bucket that holds a single token. The other
+// methods of the wrapped Queue are not limited. The priority order is preserved.
+type RateLimitedQueue struct {
+	Queue
+	mu       sync.Mutex
+	interval time.Duration
+	ready    time.Time
+}
+
+// NewRateLimitedQueue returns a RateLimitedQueue that allows perSecond elements to leave
+// q each second. A rate of zero or less removes the limit.
+func NewRateLimitedQueue(q Queue, perSecond float64) *RateLimitedQueue {
+	r := &RateLimitedQueue{Queue: q}
+
+	r.SetRate(perSecond)
+	return r
+}
+
+// SetRate changes the number of elements allowed to leave the Queue each second.
+// A rate of zero or less removes the limit.
+func (r *RateLimitedQueue) SetRate(perSecond float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var interval time.Duration
+	if perSecond > 0 {
+		interval = time.Duration(float64(time.Second) / perSecond)
+	}
+
+	// the next token becomes available according to the new rate
+	r.ready = r.ready.Add(interval - r.interval)
+	r.interval = interval
+}
+
+// Next returns the data at the front of the Queue, blocking until a token is available.
+// False is returned without waiting for data when the Queue is empty.
+func (r *RateLimitedQueue) Next() (any, bool) {
+	_ = r.wait(context.Background())
+
+	data, ok := r.Queue.Next()
+	if !ok {
+		r.refund()
+	}
+	return data, ok
+}
+
+// TryNext returns the data at the front of the Queue, or false when the Queue
+// is empty or no token is available. TryNext never blocks.
+func (r *RateLimitedQueue) TryNext() (any, bool) {
+	if r.acquire() > 0 {
+		return nil, false
+	}
+
+	data, ok := r.Queue.Next()
+	if !ok {
+		r.refund()
+	}
+	return data, ok
+}
+
+// NextContext returns the data at the front of the Queue, blocking until data and a token
+// are available, or returns the context error once ctx is cancelled or its deadline passes.
+func (r *RateLimitedQueue) NextContext(ctx context.Context) (any, bool, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, false, err
+	}
+
+	data, ok, err := r.Queue.NextContext(ctx)
+	if !ok {
+		r.refund()
+	}
+	return data, ok, err
+}
+
+// WaitNext blocks until data and a token are available, and returns the data at the front of
+// the Queue. False is only returned once the Queue has been closed and drained.
+func (r *RateLimitedQueue) WaitNext() (any, bool) {
+	data, ok, _ := r.NextContext(context.Background())
+	return data, ok
+}
+
+// NextTimeout returns the data at the front of the Queue, waiting up to d for data and a
+// token to become available. False is returned when none arrive within d.
+func (r *RateLimitedQueue) NextTimeout(d time.Duration) (any, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	data, ok, _ := r.NextContext(ctx)
+	return data, ok
+}
+
+// Process will execute the callback parameter for each element on the Queue,
+// obtaining each element using the rate limited Next, and returns once the Queue is empty.
+func (r *RateLimitedQueue) Process(callback func(any)) {
+	element, ok := r.Next()
+
+	rel, _ := r.Queue.(interface{ releaseData(any) })
+	for ok {
+		callback(element)
+		if rel != nil {
+			rel.releaseData(element)
+		}
+		element, ok = r.Next()
+	}
+}
+
+// wait blocks until the token is taken, or returns the context error once ctx is done.
+func (r *RateLimitedQueue) wait(ctx context.Context) error {
+	for {
+		wait := r.acquire()
+		if wait <= 0 {
+			return nil
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// acquire takes the token when available, or returns the time until it will be.
+func (r *RateLimitedQueue) acquire() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.interval == 0 {
+		return 0
+	}
+
+	now := time.Now()
+	if wait := r.ready.Sub(now); wait > 0 {
+		return wait
+	}
+
+	r.ready = now.Add(r.interval)
+	return 0
+}
+
+// refund returns a token that was acquired without obtaining data.
+func (r *RateLimitedQueue) refund() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ready = r.ready.Add(-r.interval)
+}
@@ -0,0 +1,75 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitedQueue(t *testing.T) {
+	q := NewRateLimitedQueue(NewQueue(), 20)
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendPriority("norm", PriorityNormal)
+	q.AppendPriority("high", PriorityHigh)
+
+	start := time.Now()
+	for _, want := range []string{"crit", "high", "norm", "low"} {
+		if have, ok := q.Next(); !ok || have.(string) != want {
+			t.Errorf("element popped out of priority order, expected '%s' but got '%v'", want, have)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("four elements at 20 per second left the Queue after only %s", elapsed)
+	}
+
+	q.Append("first")
+	q.Append("second")
+	if _, ok := q.TryNext(); ok {
+		t.Errorf("TryNext returned an element without a token")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := q.TryNext(); !ok {
+		t.Errorf("TryNext failed to return the element once a token was available")
+	}
+	if _, ok := q.TryNext(); ok {
+		t.Errorf("TryNext returned an element without a token")
+	}
+
+	q.Append("third")
+	q.SetRate(0)
+	if _, ok := q.TryNext(); !ok {
+		t.Errorf("TryNext was limited after the limit was removed")
+	}
+}
+
+func TestRateLimitedQueueEmpty(t *testing.T) {
+	q := NewRateLimitedQueue(NewQueue(), 100)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		if _, ok := q.Next(); ok {
+			t.Errorf("Next returned an element from an empty Queue")
+		}
+
+		var count int
+		q.Append("first")
+		q.Append("second")
+		q.Process(func(any) { count++ })
+		if count != 2 {
+			t.Errorf("expected Process to handle 2 elements, but it handled %d", count)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Next or Process blocked on an empty Queue")
+	}
+}
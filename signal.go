@@ -0,0 +1,56 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+// SignalPriority implements the Queue interface.
+func (q *queue) SignalPriority(priority QueuePriority) <-chan struct{} {
+	q.Lock()
+	defer q.Unlock()
+
+	priority = q.store.fit(priority)
+	if ch, found := q.prioritySignals[priority]; found {
+		return ch
+	}
+
+	ch := make(chan struct{}, 1)
+	if q.closed {
+		close(ch)
+		return ch
+	}
+
+	q.store.walk(func(e element) bool {
+		if e.priority >= priority {
+			ch <- struct{}{}
+			return false
+		}
+		return true
+	})
+	if q.prioritySignals == nil {
+		q.prioritySignals = make(map[QueuePriority]chan struct{})
+	}
+	q.prioritySignals[priority] = ch
+	return ch
+}
+
+// assertPriority leaves a token in the channels of the levels at or below the priority.
+func (q *queue) assertPriority(priority QueuePriority) {
+	for p, ch := range q.prioritySignals {
+		if priority < p {
+			continue
+		}
+
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (q *queue) closePrioritySignals() {
+	for _, ch := range q.prioritySignals {
+		close(ch)
+	}
+	q.prioritySignals = nil
+}
@@ -0,0 +1,71 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "testing"
+
+func TestSignalPriority(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("early", PriorityCritical)
+	critical := q.SignalPriority(PriorityCritical)
+	if q.SignalPriority(PriorityCritical) != critical {
+		t.Errorf("SignalPriority returned a different channel for the same level")
+	}
+	select {
+	case <-critical:
+	default:
+		t.Errorf("the signal was not asserted for the data already queued")
+	}
+	_, _ = q.Next()
+
+	high := q.SignalPriority(PriorityHigh)
+	q.Append("normal")
+	select {
+	case <-critical:
+		t.Errorf("the critical signal was asserted for data at a lower priority")
+	case <-high:
+		t.Errorf("the high signal was asserted for data at a lower priority")
+	default:
+	}
+
+	q.AppendPriority("critical", PriorityCritical)
+	for name, ch := range map[string]<-chan struct{}{"critical": critical, "high": high} {
+		select {
+		case <-ch:
+		default:
+			t.Errorf("the %s signal was not asserted for data at the critical priority", name)
+		}
+	}
+	if data, ok := q.NextAtLeast(PriorityCritical); !ok || data != "critical" {
+		t.Errorf("expected 'critical' to be returned, got '%v'", data)
+	}
+
+	// data promoted to the critical priority also asserts the signal
+	for _, tc := range []struct {
+		name    string
+		promote func()
+	}{
+		{"UpdatePriority", func() { q.UpdatePriority("normal", PriorityCritical) }},
+		{"MoveAll", func() { q.MoveAll(PriorityNormal, PriorityCritical) }},
+	} {
+		q.Clear()
+		q.Append("normal")
+		tc.promote()
+		select {
+		case <-critical:
+		default:
+			t.Errorf("the critical signal was not asserted for data promoted by %s", tc.name)
+		}
+	}
+
+	q.Close()
+	if _, ok := <-critical; ok {
+		t.Errorf("the critical signal channel was not closed")
+	}
+	if _, ok := <-q.SignalPriority(PriorityLow); ok {
+		t.Errorf("SignalPriority returned an open channel on a closed queue")
+	}
+}
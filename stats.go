@@ -0,0 +1,59 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "unsafe"
+
+// Stats is a snapshot of the state of a Queue.
+type Stats struct {
+	// Len is the current length of the Queue.
+	Len int
+	// LenPriority is the current number of elements at each of the priority levels.
+	LenPriority map[QueuePriority]int
+	// Appended is the number of elements added since the Queue was created.
+	Appended uint64
+	// Dequeued is the number of elements removed by Next, or the other methods
+	// returning data such as NextN and DrainAll, since the Queue was created.
+	Dequeued uint64
+}
+
+// Stats implements the Queue interface.
+func (q *queue) Stats() Stats {
+	q.Lock()
+	defer q.Unlock()
+
+	stats := Stats{
+		Len:      q.store.len(),
+		Appended: q.appended,
+		Dequeued: q.dequeued,
+	}
+
+	stats.LenPriority = make(map[QueuePriority]int, numLevels)
+	q.store.eachLevel(func(p QueuePriority, n int) {
+		stats.LenPriority[p] = n
+	})
+	return stats
+}
+
+// elementSize is the memory used by the bookkeeping of each element.
+const elementSize = int(unsafe.Sizeof(element{}))
+
+// ApproxBytes implements the Queue interface.
+func (q *queue) ApproxBytes(sizeof func(any) int) int {
+	q.Lock()
+	defer q.Unlock()
+
+	total := q.store.footprint() + q.stamps.footprint()
+	q.store.walk(func(e element) bool {
+		total += sizeof(e.data)
+		return true
+	})
+	if q.held != nil {
+		for _, w := range q.held.pending {
+			total += sizeof(w.e.data)
+		}
+	}
+	return total
+}
@@ -0,0 +1,81 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	q := NewQueue()
+
+	q.AppendPriority("crit", PriorityCritical)
+	q.AppendAll([]any{"low1", "low2", "low3"}, PriorityLow)
+	q.Append("norm")
+	_, _ = q.Next()
+	_ = q.NextN(2)
+
+	stats := q.Stats()
+	if stats.Len != 2 {
+		t.Errorf("expected a length of 2, got %d", stats.Len)
+	}
+	if stats.Appended != 5 {
+		t.Errorf("expected 5 appended elements, got %d", stats.Appended)
+	}
+	if stats.Dequeued != 3 {
+		t.Errorf("expected 3 dequeued elements, got %d", stats.Dequeued)
+	}
+	expected := map[QueuePriority]int{
+		PriorityLow:      2,
+		PriorityNormal:   0,
+		PriorityHigh:     0,
+		PriorityCritical: 0,
+	}
+	for priority, want := range expected {
+		if have := stats.LenPriority[priority]; have != want {
+			t.Errorf("priority %d returned a length of %d instead of %d", priority, have, want)
+		}
+	}
+
+	_ = q.DrainAll()
+	if stats = q.Stats(); stats.Len != 0 || stats.Dequeued != 5 {
+		t.Errorf("expected all 5 elements to be dequeued, got %d with %d remaining", stats.Dequeued, stats.Len)
+	}
+}
+
+func TestApproxBytes(t *testing.T) {
+	q := NewQueue()
+	sizeof := func(data any) int { return len(data.(string)) }
+
+	if n := q.ApproxBytes(sizeof); n != 0 {
+		t.Errorf("expected an empty queue to hold no memory, got %d bytes", n)
+	}
+
+	// each level holding data allocates a ring of minRing elements
+	q.Append("four")
+	q.AppendPriority("sixsix", PriorityHigh)
+	if n, want := q.ApproxBytes(sizeof), 10+2*minRing*elementSize; n != want {
+		t.Errorf("expected an estimate of %d bytes, got %d", want, n)
+	}
+
+	// the capacity retained after data is removed is counted until ShrinkToFit
+	for i := 0; i < 100; i++ {
+		q.AppendPriority("x", PriorityLow)
+	}
+	_ = q.NextN(q.Len() - 32)
+	before := q.ApproxBytes(sizeof)
+	q.ShrinkToFit()
+	if after := q.ApproxBytes(sizeof); after >= before {
+		t.Errorf("expected ShrinkToFit to lower the estimate of %d bytes, got %d", before, after)
+	}
+
+	// the delayed data is counted along with the heap holding it
+	d := NewDelayQueue()
+	d.AppendDelayed("delayed", PriorityNormal, time.Now().Add(time.Hour))
+	if n := d.ApproxBytes(sizeof); n < 7+elementSize {
+		t.Errorf("expected the delayed data to be counted, got %d bytes", n)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+// TypedQueue wraps a Queue to provide type-safe access to elements of type T.
+type TypedQueue[T any] struct {
+	q Queue
+}
+
+// NewTypedQueue returns an initialized TypedQueue.
+func NewTypedQueue[T any]() *TypedQueue[T] {
+	return &TypedQueue[T]{q: NewQueue()}
+}
+
+// Append adds the data to the TypedQueue at priority level PriorityNormal.
+func (t *TypedQueue[T]) Append(data T) {
+	t.q.Append(data)
+}
+
+// AppendPriority adds the data to the TypedQueue with respect to priority.
+func (t *TypedQueue[T]) AppendPriority(data T, priority QueuePriority) {
+	t.q.AppendPriority(data, priority)
+}
+
+// Signal returns the TypedQueue signal channel.
+func (t *TypedQueue[T]) Signal() <-chan struct{} {
+	return t.q.Signal()
+}
+
+// Next returns the data at the front of the TypedQueue.
+// The zero value of T is returned when the TypedQueue is empty.
+func (t *TypedQueue[T]) Next() (T, bool) {
+	return typed[T](t.q.Next())
+}
+
+// Peek returns the data at the front of the TypedQueue
+// without changing the TypedQueue.
+func (t *TypedQueue[T]) Peek() (T, bool) {
+	return typed[T](t.q.Peek())
+}
+
+// Items returns a copy of all the data on the TypedQueue in the order it
+// would be removed. The TypedQueue is not changed.
+func (t *TypedQueue[T]) Items() []T {
+	snapshot := t.q.Snapshot()
+
+	items := make([]T, 0, len(snapshot))
+	for _, data := range snapshot {
+		v, _ := typed[T](data, true)
+		items = append(items, v)
+	}
+	return items
+}
+
+// Empty returns true if the TypedQueue is empty.
+func (t *TypedQueue[T]) Empty() bool {
+	return t.q.Empty()
+}
+
+// Len returns the current length of the TypedQueue.
+func (t *TypedQueue[T]) Len() int {
+	return t.q.Len()
+}
+
+func typed[T any](data any, ok bool) (T, bool) {
+	var zero T
+
+	if !ok {
+		return zero, false
+	}
+	if v, valid := data.(T); valid {
+		return v, true
+	}
+	return zero, true
+}
+
+// MapQueue wraps a TypedQueue to transform each element of type T into a U as it is
+// removed. The priority order and the signal channel are those of the source TypedQueue.
+type MapQueue[T, U any] struct {
+	src *TypedQueue[T]
+	f   func(T) U
+}
+
+// NewMapQueue returns an initialized MapQueue that removes elements from src and passes
+// them through f.
+func NewMapQueue[T, U any](src *TypedQueue[T], f func(T) U) *MapQueue[T, U] {
+	return &MapQueue[T, U]{src: src, f: f}
+}
+
+// Signal returns the signal channel of the source TypedQueue.
+func (m *MapQueue[T, U]) Signal() <-chan struct{} {
+	return m.src.Signal()
+}
+
+// Next removes the data at the front of the source TypedQueue and returns it transformed.
+// The zero value of U is returned when the source TypedQueue is empty.
+func (m *MapQueue[T, U]) Next() (U, bool) {
+	data, ok := m.src.Next()
+	if !ok {
+		var zero U
+		return zero, false
+	}
+	return m.f(data), true
+}
+
+// Empty returns true if the source TypedQueue is empty.
+func (m *MapQueue[T, U]) Empty() bool {
+	return m.src.Empty()
+}
+
+// Len returns the current length of the source TypedQueue.
+func (m *MapQueue[T, U]) Len() int {
+	return m.src.Len()
+}
@@ -0,0 +1,84 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestTypedQueue(t *testing.T) {
+	q := NewTypedQueue[int]()
+
+	q.AppendPriority(1, PriorityLow)
+	q.AppendPriority(2, PriorityCritical)
+	q.Append(3)
+	if l := q.Len(); l != 3 {
+		t.Errorf("expected the queue to contain 3 elements, got %d", l)
+	}
+	if e, ok := q.Peek(); !ok || e != 2 {
+		t.Errorf("Peek returned %d instead of 2", e)
+	}
+
+	for _, want := range []int{2, 3, 1} {
+		if have, ok := q.Next(); !ok || have != want {
+			t.Errorf("element popped out of priority order, expected %d but got %d", want, have)
+		}
+	}
+	if e, ok := q.Next(); ok || e != 0 {
+		t.Errorf("an empty TypedQueue returned %d and %t instead of the zero value", e, ok)
+	}
+	if !q.Empty() {
+		t.Errorf("expected the queue to be empty after popping inserted elements")
+	}
+}
+
+func TestTypedQueueItems(t *testing.T) {
+	q := NewTypedQueue[string]()
+	if items := q.Items(); len(items) != 0 {
+		t.Errorf("expected an empty TypedQueue to return no items, got %v", items)
+	}
+
+	q.AppendPriority("low", PriorityLow)
+	q.AppendPriority("critical", PriorityCritical)
+	q.Append("normal")
+
+	want := []string{"critical", "normal", "low"}
+	items := q.Items()
+	if len(items) != len(want) {
+		t.Fatalf("expected %d items, got %d", len(want), len(items))
+	}
+	for i, w := range want {
+		if items[i] != w {
+			t.Errorf("expected item %d to be %s, got %s", i, w, items[i])
+		}
+	}
+	if l := q.Len(); l != 3 {
+		t.Errorf("expected Items to leave 3 elements on the queue, got %d", l)
+	}
+}
+
+func TestMapQueue(t *testing.T) {
+	src := NewTypedQueue[int]()
+	m := NewMapQueue(src, func(n int) string { return strconv.Itoa(n * 10) })
+
+	src.AppendPriority(1, PriorityLow)
+	src.AppendPriority(2, PriorityHigh)
+	if l := m.Len(); l != 2 {
+		t.Errorf("expected the MapQueue to report 2 elements, got %d", l)
+	}
+	if _, ok := <-m.Signal(); !ok {
+		t.Errorf("the signal of the source queue was not passed through")
+	}
+
+	for _, want := range []string{"20", "10"} {
+		if have, ok := m.Next(); !ok || have != want {
+			t.Errorf("expected the transformed element '%s' but got '%s'", want, have)
+		}
+	}
+	if have, ok := m.Next(); ok || have != "" || !m.Empty() {
+		t.Errorf("an empty MapQueue returned '%s' and %t instead of the zero value", have, ok)
+	}
+}
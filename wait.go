@@ -0,0 +1,74 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "time"
+
+// waitBounds are the upper bounds of the WaitHistogram buckets.
+var waitBounds = [...]time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// WithWaitTracking records the time each element spends on the Queue before it is removed
+// by Next, or the other methods returning data such as NextN and DrainAll, which is
+// summarized by AverageWait and WaitHistogram. Without this option, both methods report
+// no data.
+func WithWaitTracking() Option {
+	return func(q *queue) {
+		q.waits = &waitStats{}
+		q.stamped = true
+	}
+}
+
+// waitStats accumulates the wait times observed since they were last read.
+type waitStats struct {
+	total   time.Duration
+	count   uint64
+	buckets [len(waitBounds) + 1]uint64
+}
+
+func (w *waitStats) observe(waited time.Duration) {
+	w.total += waited
+	w.count++
+
+	i := 0
+	for i < len(waitBounds) && waited > waitBounds[i] {
+		i++
+	}
+	w.buckets[i]++
+}
+
+// AverageWait implements the Queue interface.
+func (q *queue) AverageWait() time.Duration {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.waits == nil || q.waits.count == 0 {
+		return 0
+	}
+
+	avg := q.waits.total / time.Duration(q.waits.count)
+	q.waits.total = 0
+	q.waits.count = 0
+	return avg
+}
+
+// WaitHistogram implements the Queue interface.
+func (q *queue) WaitHistogram() []uint64 {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.waits == nil {
+		return make([]uint64, len(waitBounds)+1)
+	}
+
+	counts := q.waits.buckets
+	q.waits.buckets = [len(waitBounds) + 1]uint64{}
+	return counts[:]
+}
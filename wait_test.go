@@ -0,0 +1,54 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAverageWait(t *testing.T) {
+	if avg := NewQueue().AverageWait(); avg != 0 {
+		t.Errorf("a Queue without wait tracking reported an average wait of %v", avg)
+	}
+
+	q := NewQueue(WithWaitTracking())
+	if avg := q.AverageWait(); avg != 0 {
+		t.Errorf("an unused Queue reported an average wait of %v", avg)
+	}
+
+	q.Append("first")
+	q.Append("second")
+	time.Sleep(50 * time.Millisecond)
+	_ = q.NextN(2)
+	if avg := q.AverageWait(); avg < 50*time.Millisecond || avg > time.Second {
+		t.Errorf("expected an average wait of about 50ms, got %v", avg)
+	}
+	if avg := q.AverageWait(); avg != 0 {
+		t.Errorf("the average wait was not reset after being read, got %v", avg)
+	}
+}
+
+func TestWaitHistogram(t *testing.T) {
+	q := NewQueue(WithWaitTracking())
+
+	q.Append("slow")
+	time.Sleep(20 * time.Millisecond)
+	q.Append("fast")
+	_ = q.DrainAll()
+
+	counts := q.WaitHistogram()
+	if len(counts) != len(waitBounds)+1 {
+		t.Fatalf("expected %d buckets, got %d", len(waitBounds)+1, len(counts))
+	}
+	if counts[0] != 1 || counts[2] != 1 {
+		t.Errorf("the waits were counted in the wrong buckets: %v", counts)
+	}
+	for i, c := range q.WaitHistogram() {
+		if c != 0 {
+			t.Errorf("bucket %d was not reset after being read, got %d", i, c)
+		}
+	}
+}
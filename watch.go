@@ -0,0 +1,51 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+// Watch implements the Queue interface.
+func (q *queue) Watch() <-chan int {
+	q.Lock()
+	defer q.Unlock()
+
+	ch := make(chan int, 1)
+	if q.closed {
+		close(ch)
+		return ch
+	}
+
+	q.watchedLen = q.store.len()
+	ch <- q.watchedLen
+	q.watchers = append(q.watchers, ch)
+	return ch
+}
+
+// publishLen sends the length of the Queue to the watchers when it has changed. A value
+// not yet received is replaced, so a watcher only ever waits on the latest length.
+func (q *queue) publishLen() {
+	if len(q.watchers) == 0 {
+		return
+	}
+
+	n := q.store.len()
+	if n == q.watchedLen {
+		return
+	}
+
+	q.watchedLen = n
+	for _, ch := range q.watchers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- n
+	}
+}
+
+func (q *queue) closeWatchers() {
+	for _, ch := range q.watchers {
+		close(ch)
+	}
+	q.watchers = nil
+}
@@ -0,0 +1,48 @@
+// Copyright © by Jeff Foley 2017-2025. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+// SPDX-License-Identifier: Apache-2.0
+
+package queue
+
+import "testing"
+
+func TestWatch(t *testing.T) {
+	q := NewQueue()
+
+	q.Append("first")
+	ch := q.Watch()
+	if n := <-ch; n != 1 {
+		t.Errorf("the watcher received %d instead of the current length", n)
+	}
+
+	// a burst is coalesced into the latest length
+	q.AppendAll([]any{"second", "third"}, PriorityNormal)
+	q.Append("fourth")
+	if n := <-ch; n != 4 {
+		t.Errorf("the watcher received %d instead of the latest length of four", n)
+	}
+	select {
+	case n := <-ch:
+		t.Errorf("the watcher received a stale length of %d", n)
+	default:
+	}
+
+	_, _ = q.Next()
+	if n := <-ch; n != 3 {
+		t.Errorf("the watcher received %d instead of three after Next", n)
+	}
+	q.Peek()
+	select {
+	case n := <-ch:
+		t.Errorf("the watcher received %d without the length changing", n)
+	default:
+	}
+
+	q.Close()
+	if _, ok := <-ch; ok {
+		t.Errorf("the watch channel was not closed by Close")
+	}
+	if _, ok := <-q.Watch(); ok {
+		t.Errorf("a closed Queue returned an open watch channel")
+	}
+}